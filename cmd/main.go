@@ -30,6 +30,18 @@ func main() {
 	}
 	defer components.Shutdown()
 
+	// clicks are counted until the servers are drained, so flushers are stopped after them
+	flushCtx, stopFlushers := context.WithCancel(context.Background())
+	flushers := errgroup.Group{}
+
+	flushers.Go(func() error {
+		return components.Hits.Run(flushCtx)
+	})
+
+	flushers.Go(func() error {
+		return components.Analytics.Run(flushCtx)
+	})
+
 	eg, ctx := errgroup.WithContext(context.Background())
 	sigQuit := make(chan os.Signal, 1)
 	signal.Notify(sigQuit, syscall.SIGINT, syscall.SIGTERM)
@@ -38,6 +50,22 @@ func main() {
 		return components.HttpServer.Run(ctx)
 	})
 
+	eg.Go(func() error {
+		return components.Sweeper.Run(ctx)
+	})
+
+	eg.Go(func() error {
+		return components.Cache.Run(ctx)
+	})
+
+	eg.Go(func() error {
+		return components.Breaker.Run(ctx)
+	})
+
+	eg.Go(func() error {
+		return components.Warmer.Run(ctx)
+	})
+
 	eg.Go(func() error {
 		select {
 		case <-ctx.Done():
@@ -51,4 +79,8 @@ func main() {
 
 	err = eg.Wait()
 	logger.Info("Gracefully shutting down the servers", slog.String("error", err.Error()))
+
+	components.HttpServer.Stop()
+	stopFlushers()
+	_ = flushers.Wait()
 }
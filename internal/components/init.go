@@ -1,16 +1,26 @@
 package components
 
 import (
+	"context"
+	"expvar"
+	"fmt"
+	"url-shortner/internal/domain"
 	"url-shortner/internal/ports"
+	"url-shortner/internal/services/analytics"
+	"url-shortner/internal/services/canonical"
 	"url-shortner/internal/services/encoder"
+	"url-shortner/internal/services/hits"
 	"url-shortner/internal/services/render"
 	"url-shortner/internal/services/url_shortener"
 
 	"log/slog"
 	"os"
+	"time"
 	"url-shortner/internal/config"
+	"url-shortner/internal/storage/memory"
 	"url-shortner/internal/storage/pg"
 	"url-shortner/internal/storage/redis"
+	"url-shortner/pkg/bloom"
 	"url-shortner/pkg/logger/slogpretty"
 )
 
@@ -18,10 +28,28 @@ const (
 	envLocal = "local"
 	envDev   = "dev"
 	envProd  = "prod"
+
+	encoderSequential = "sequential"
+	encoderObfuscated = "obfuscated"
+
+	strategySequential = "sequential"
+	strategyRandom     = "random"
+	strategyHash       = "hash"
+
+	backfillBatchSize = 1000
+
+	// cacheMigrationTimeout bounds the migration of legacy cache keys, so that it never hangs the start
+	cacheMigrationTimeout = 30 * time.Second
 )
 
 type Components struct {
 	HttpServer *ports.Server
+	Sweeper    *url_shortener.Sweeper
+	Hits       *hits.Counter
+	Analytics  *analytics.Analytics
+	Cache      *memory.LRU
+	Breaker    *redis.Breaker
+	Warmer     *url_shortener.Warmer
 	Postgres   *pg.Postgres
 	Redis      *redis.Redis
 }
@@ -37,13 +65,87 @@ func InitComponents(cfg *config.Config, logger *slog.Logger) (*Components, error
 		return nil, err
 	}
 
-	encoder := encoder.New()
+	// the legacy keys are never read, so they are left for the next start, if Redis is unavailable
+	if rds.Available() {
+		migrateCtx, cancel := context.WithTimeout(context.Background(), cacheMigrationTimeout)
+		err = rds.DropLegacyKeys(migrateCtx)
+		if err == nil {
+			err = rds.MigrateHash(migrateCtx)
+		}
+		cancel()
+
+		if err != nil {
+			logger.Warn("failed to migrate cache", slog.String("error", err.Error()))
+		}
+	}
+
+	breaker := redis.NewBreaker(rds, logger, &cfg.Redis)
+
+	alphabet, err := encoder.NewCustom(cfg.Encoder.Alphabet, cfg.Encoder.MinLength, cfg.Encoder.CaseInsensitive)
+	if err != nil {
+		return nil, fmt.Errorf("components.InitComponents: %w", err)
+	}
+
+	if cfg.Encoder.CheckDigit {
+		alphabet, err = alphabet.WithCheckDigit()
+		if err != nil {
+			return nil, fmt.Errorf("components.InitComponents: %w", err)
+		}
+	}
+
+	codec, err := newCodec(alphabet, cfg.Encoder.Mode, cfg.Encoder.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	// links created before codes were stored got codes of the default alphabet
+	legacyCodec, err := newCodec(encoder.New(), cfg.Encoder.Mode, cfg.Encoder.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	generator, err := newGenerator(&cfg.Encoder, alphabet, codec)
+	if err != nil {
+		return nil, err
+	}
+
+	clickAnalytics := analytics.New(logger, postgres, cfg.Analytics.QueueSize, cfg.Analytics.BatchSize, cfg.Analytics.FlushInterval)
 
 	render := render.New(cfg.TemplatesPath, logger)
 
-	serviceURLShortener := url_shortener.New(logger, rds, postgres)
+	hitCounter := hits.New(logger, postgres, cfg.Hits.FlushInterval)
+
+	if cfg.Cache.Size <= 0 {
+		return nil, fmt.Errorf("components.InitComponents: cache size should be positive, got %d", cfg.Cache.Size)
+	}
+
+	cache := memory.NewLRU(logger, breaker, cfg.Cache.Size, cfg.Cache.TTL)
+	expvar.Publish("cache", expvar.Func(func() any { return cache.Stats() }))
+
+	var filter url_shortener.Filter
+	if cfg.Bloom.Enabled {
+		filter = bloom.New(cfg.Bloom.Capacity, cfg.Bloom.FalsePositiveRate)
+	}
+
+	serviceURLShortener := url_shortener.New(logger, cache, postgres, generator, hitCounter, canonical.New(cfg.Canonical.StripTracking), filter)
+
+	err = serviceURLShortener.BackfillCodes(context.Background(), encoder.NewSequential(legacyCodec), backfillBatchSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// codes created by other replicas are added to the filter, which is built once subscribed to them,
+	// so that no code created meanwhile is missed. Proxy does not consult the filter until it is built.
+	cache.OnInvalidation(serviceURLShortener.AddCodes)
+
+	warmer, err := newWarmer(&cfg.Warmup, logger, serviceURLShortener)
+	if err != nil {
+		return nil, err
+	}
+
+	sweeper := url_shortener.NewSweeper(logger, serviceURLShortener, cfg.Expiration.SweepInterval, cfg.Expiration.Retention)
 
-	httpServer, err := ports.NewServer(&cfg.Http, logger, serviceURLShortener, encoder, render)
+	httpServer, err := ports.NewServer(&cfg.Http, logger, serviceURLShortener, codec, legacyCodec, clickAnalytics, render)
 	if err != nil {
 		return nil, err
 	}
@@ -52,15 +154,62 @@ func InitComponents(cfg *config.Config, logger *slog.Logger) (*Components, error
 		Postgres:   postgres,
 		Redis:      rds,
 		HttpServer: httpServer,
+		Sweeper:    sweeper,
+		Hits:       hitCounter,
+		Analytics:  clickAnalytics,
+		Cache:      cache,
+		Breaker:    breaker,
+		Warmer:     warmer,
 	}, nil
 }
 
+// Shutdown closes the storages, servers should be stopped and clicks flushed before.
 func (c *Components) Shutdown() {
-	c.HttpServer.Stop()
 	c.Postgres.CloseConnection()
 	c.Redis.Close()
 }
 
+func newGenerator(cfg *config.EncoderConfig, alphabet *encoder.Encoder, codec encoder.Codec) (url_shortener.Generator, error) {
+	switch cfg.Strategy {
+	case strategySequential:
+		return encoder.NewSequential(codec), nil
+	case strategyRandom:
+		return encoder.NewRandom(alphabet, cfg.CodeLength)
+	case strategyHash:
+		return encoder.NewHash(alphabet, cfg.CodeLength)
+	default:
+		return nil, fmt.Errorf("components.newGenerator: unknown encoder strategy %q", cfg.Strategy)
+	}
+}
+
+func newWarmer(cfg *config.WarmupConfig, logger *slog.Logger, shortener *url_shortener.URLShortener) (*url_shortener.Warmer, error) {
+	order := domain.LinkOrder(cfg.Order)
+	if order != domain.OrderByClicks && order != domain.OrderByRecent {
+		return nil, fmt.Errorf("components.newWarmer: unknown warmup order %q", cfg.Order)
+	}
+
+	if cfg.Rate <= 0 {
+		return nil, fmt.Errorf("components.newWarmer: warmup rate should be positive, got %d", cfg.Rate)
+	}
+
+	return url_shortener.NewWarmer(logger, shortener, order, cfg.Size, cfg.Rate), nil
+}
+
+func newCodec(alphabet *encoder.Encoder, mode, secret string) (encoder.Codec, error) {
+	switch mode {
+	case encoderSequential:
+		return alphabet, nil
+	case encoderObfuscated:
+		if secret == "" {
+			return nil, fmt.Errorf("components.newCodec: secret is required for %q mode", mode)
+		}
+
+		return encoder.NewObfuscated(alphabet, secret), nil
+	default:
+		return nil, fmt.Errorf("components.newCodec: unknown encoder mode %q", mode)
+	}
+}
+
 func SetupLogger(env string) *slog.Logger {
 	var logger *slog.Logger
 
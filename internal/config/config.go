@@ -13,7 +13,15 @@ type Config struct {
 	Env           string `env:"ENV" env-default:"local"`
 	Postgres      PostgresConfig
 	Redis         RedisConfig
+	Cache         CacheConfig
+	Bloom         BloomConfig
+	Warmup        WarmupConfig
+	Canonical     CanonicalConfig
 	Http          HTTPConfig
+	Expiration    ExpirationConfig
+	Hits          HitsConfig
+	Analytics     AnalyticsConfig
+	Encoder       EncoderConfig
 	TemplatesPath string `env:"TEMPLATES_PATH" env-required:"true"`
 }
 
@@ -22,7 +30,17 @@ type HTTPConfig struct {
 	ReadTimeout     time.Duration `env:"READ_TIMEOUT" env-default:"10s"`
 	WriteTimeout    time.Duration `env:"WRITE_TIMEOUT" env-default:"10s"`
 	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" env-default:"10s"`
-	Limiter         Limiter
+	// DebugAddr is the internal address of /debug/vars, which is not served if empty
+	DebugAddr string `env:"DEBUG_ADDR" env-default:"localhost:6060"`
+	// AdminAddr is the internal address of the api listing and changing all links, which is not served if empty
+	AdminAddr string `env:"ADMIN_ADDR" env-default:"localhost:8081"`
+	// RedirectType is the status code of redirects for links created without one
+	RedirectType int `env:"REDIRECT_TYPE" env-default:"302"`
+	// RedirectMaxAge is how long clients may cache permanent redirects
+	RedirectMaxAge time.Duration `env:"REDIRECT_MAX_AGE" env-default:"24h"`
+	// BatchSize is the maximum number of urls created by a single bulk request
+	BatchSize int `env:"BATCH_SIZE" env-default:"1000"`
+	Limiter   Limiter
 }
 
 type Limiter struct {
@@ -31,6 +49,43 @@ type Limiter struct {
 	TTL   time.Duration `env:"LIMITER_TTL" env-default:"10m"`
 }
 
+type ExpirationConfig struct {
+	SweepInterval time.Duration `env:"EXPIRATION_SWEEP_INTERVAL" env-default:"1h"`
+	Retention     time.Duration `env:"EXPIRATION_RETENTION" env-default:"720h"`
+}
+
+type HitsConfig struct {
+	FlushInterval time.Duration `env:"HITS_FLUSH_INTERVAL" env-default:"10s"`
+}
+
+type AnalyticsConfig struct {
+	QueueSize     int           `env:"ANALYTICS_QUEUE_SIZE" env-default:"10000"`
+	BatchSize     int           `env:"ANALYTICS_BATCH_SIZE" env-default:"500"`
+	FlushInterval time.Duration `env:"ANALYTICS_FLUSH_INTERVAL" env-default:"5s"`
+}
+
+// EncoderConfig selects how short codes of new links are generated.
+// Mode and Secret define how link ids are turned into codes by the sequential strategy,
+// they are also used to backfill codes of links created before codes were stored.
+// Codes are stored, so changing the config afterwards does not affect existing links.
+type EncoderConfig struct {
+	Strategy   string `env:"ENCODER_STRATEGY" env-default:"sequential"`
+	CodeLength int    `env:"ENCODER_CODE_LENGTH" env-default:"7"`
+	Mode       string `env:"ENCODER_MODE" env-default:"sequential"`
+	Secret     string `env:"ENCODER_SECRET"`
+	// Alphabet, MinLength, CaseInsensitive and CheckDigit only apply to new links
+	Alphabet        string `env:"ENCODER_ALPHABET" env-default:"abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"`
+	MinLength       int    `env:"ENCODER_MIN_LENGTH" env-default:"0"`
+	CaseInsensitive bool   `env:"ENCODER_CASE_INSENSITIVE" env-default:"false"`
+	CheckDigit      bool   `env:"ENCODER_CHECK_DIGIT" env-default:"false"`
+}
+
+// CacheConfig limits the in-process cache in front of Redis
+type CacheConfig struct {
+	Size int           `env:"CACHE_SIZE" env-default:"10000"`
+	TTL  time.Duration `env:"CACHE_TTL" env-default:"1m"`
+}
+
 type PostgresConfig struct {
 	PostgresURL string `env:"POSTGRES_URL" env-required:"true"`
 }
@@ -38,6 +93,35 @@ type PostgresConfig struct {
 type RedisConfig struct {
 	Hosts    []string `env:"REDIS_HOSTS" yaml:"hosts" env-required:"true"`
 	Password string   `env:"REDIS_PASSWORD" env-required:"true"`
+	// TTL of cached links, links are cached again on the next redirect after expiration
+	TTL time.Duration `env:"REDIS_TTL" env-default:"24h"`
+	// MissingTTL of codes cached as missing
+	MissingTTL time.Duration `env:"REDIS_MISSING_TTL" env-default:"1m"`
+	// Timeout of every call, the cache is bypassed after FailureThreshold failed calls in a row
+	// and Redis is pinged every ProbeInterval until it answers
+	Timeout          time.Duration `env:"REDIS_TIMEOUT" env-default:"100ms"`
+	FailureThreshold int           `env:"REDIS_FAILURE_THRESHOLD" env-default:"5"`
+	ProbeInterval    time.Duration `env:"REDIS_PROBE_INTERVAL" env-default:"1s"`
+}
+
+// WarmupConfig selects links preloaded into the cache at startup.
+// Order is either clicks or recent, Rate limits links read and cached per second.
+type WarmupConfig struct {
+	Size  int    `env:"WARMUP_SIZE" env-default:"1000"`
+	Order string `env:"WARMUP_ORDER" env-default:"clicks"`
+	Rate  int    `env:"WARMUP_RATE" env-default:"1000"`
+}
+
+// CanonicalConfig controls how urls are canonicalized before deduplication
+type CanonicalConfig struct {
+	StripTracking bool `env:"CANONICAL_STRIP_TRACKING" env-default:"true"`
+}
+
+// BloomConfig sizes the optional filter of existing codes
+type BloomConfig struct {
+	Enabled           bool    `env:"BLOOM_ENABLED" env-default:"false"`
+	Capacity          int     `env:"BLOOM_CAPACITY" env-default:"10000000"`
+	FalsePositiveRate float64 `env:"BLOOM_FALSE_POSITIVE_RATE" env-default:"0.01"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -0,0 +1,41 @@
+package domain
+
+import "time"
+
+// Click is a single redirect of a link
+type Click struct {
+	LinkID    int
+	ClickedAt time.Time
+	Referrer  string
+	Browser   string
+	OS        string
+	Device    string
+	Bot       bool
+}
+
+// ClickBucket is a number of clicks within a time bucket
+type ClickBucket struct {
+	Time   time.Time
+	Clicks int64
+}
+
+// ReferrerClicks is a number of clicks coming from a referrer host
+type ReferrerClicks struct {
+	Referrer string
+	Clicks   int64
+}
+
+// ClickReport is aggregated click analytics of a link
+type ClickReport struct {
+	Buckets      []ClickBucket
+	TopReferrers []ReferrerClicks
+	BotClicks    int64
+}
+
+// ClickFilter defines the period and the granularity of click report
+type ClickFilter struct {
+	LinkID   int
+	Interval string
+	From     time.Time
+	To       time.Time
+}
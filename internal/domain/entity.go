@@ -1,6 +1,52 @@
 package domain
 
+import "time"
+
 type Link struct {
-	ID  int
-	URL string
+	ID   int
+	Code string
+	URL  string
+	// CanonicalURL is the form of URL used to deduplicate links
+	CanonicalURL string
+	Alias        string
+	ExpiresOn    *time.Time
+	// RedirectType is the status code of the redirect, zero means the configured default
+	RedirectType int
+	Clicks       int64
+}
+
+// Expired reports whether the link has an expiration date which is already passed.
+func (l *Link) Expired(now time.Time) bool {
+	return l.ExpiresOn != nil && !now.Before(*l.ExpiresOn)
 }
+
+// Dedupable reports whether the link may be shared by all requests for its url.
+// Links with alias, expiration or own redirect type are always new.
+func (l *Link) Dedupable() bool {
+	return l.Alias == "" && l.ExpiresOn == nil && l.RedirectType == 0
+}
+
+// LinkResult is the outcome of creating a link of a batch, either the link or the error
+type LinkResult struct {
+	Link *Link
+	Err  error
+}
+
+// LinkFilter defines criteria for listing links.
+// Empty fields are not applied.
+type LinkFilter struct {
+	CodePrefix string
+	URL        string
+	Host       string
+	Keyword    string
+	Offset     int
+	Limit      int
+}
+
+// LinkOrder defines which links come first, when links are preloaded into the cache
+type LinkOrder string
+
+const (
+	OrderByClicks LinkOrder = "clicks"
+	OrderByRecent LinkOrder = "recent"
+)
@@ -3,5 +3,15 @@ package domain
 import "errors"
 
 var (
-	ErrURLNotFound = errors.New("requested resource is not found")
+	ErrURLNotFound  = errors.New("requested resource is not found")
+	ErrURLGone      = errors.New("requested resource is expired")
+	ErrAliasTaken   = errors.New("alias is already taken")
+	ErrCodeTaken    = errors.New("short code is already taken")
+	ErrCodeMistyped = errors.New("short code has invalid check digit, it may be mistyped")
+	ErrCodeOverflow = errors.New("short code is out of id range")
+
+	// ErrCodesExhausted is returned when every generated code collided, which is a failure of the server
+	ErrCodesExhausted = errors.New("failed to generate a free short code")
+
+	ErrCacheUnavailable = errors.New("cache is unavailable")
 )
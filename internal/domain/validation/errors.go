@@ -4,12 +4,42 @@ import "errors"
 
 // Common errors
 var (
-	ErrInvalidURL     = errors.New("url is invalid")
-	ErrInvalidURLLen  = errors.New("url is too short or too long, should be 15-2048 chars")
-	ErrFilteredURL    = errors.New("url matches filter pattern")
-	ErrKeywordsCount  = errors.New("keywords must not be more than 10")
-	ErrKeywordLength  = errors.New("keyword must contain 2-25 characters")
-	ErrInvalidKeyword = errors.New("keyword must be alphanumeric (dash/underscore allowed)")
-	ErrInvalidDate    = errors.New("expires_on should be in 'yyyy-mm-dd hh:mm:ss' format")
-	ErrPastExpiration = errors.New("expires_on can not be date in past")
+	ErrInvalidURL      = errors.New("url is invalid")
+	ErrInvalidURLLen   = errors.New("url is too short or too long, should be 15-2048 chars")
+	ErrFilteredURL     = errors.New("url matches filter pattern")
+	ErrKeywordsCount   = errors.New("keywords must not be more than 10")
+	ErrKeywordLength   = errors.New("keyword must contain 2-25 characters")
+	ErrInvalidKeyword  = errors.New("keyword must be alphanumeric (dash/underscore allowed)")
+	ErrReservedAlias   = errors.New("alias must not look like a short code out of id range, such codes are never looked up")
+	ErrInvalidDate     = errors.New("expires_on should be in 'yyyy-mm-dd hh:mm:ss' format")
+	ErrPastExpiration  = errors.New("expires_on can not be date in past")
+	ErrInvalidPage     = errors.New("page should be a positive integer")
+	ErrInvalidPerPage  = errors.New("per_page should be an integer in 1-100 range")
+	ErrInvalidBucket   = errors.New("interval should be either 'hour' or 'day'")
+	ErrInvalidPeriod   = errors.New("from and to should be in 'yyyy-mm-dd hh:mm:ss' format and from should be before to")
+	ErrPeriodTooLong   = errors.New("period between from and to should be at most 31 days for hourly and 366 days for daily interval")
+	ErrInvalidRedirect = errors.New("redirect_type should be one of 301, 302, 307 or 308")
+	ErrBatchSize       = errors.New("urls should contain at least one and at most the allowed number of items")
+	ErrInvalidFormat   = errors.New("format should be either 'csv' or 'ndjson'")
+	ErrInvalidCode     = errors.New("code must be a short code of this service, or be equal to alias if it is set")
+	ErrInvalidClicks   = errors.New("clicks must not be negative and can only be imported with code or alias")
 )
+
+// Join joins the errors of several invalid fields, errors joined before are flattened
+// A single error is returned as is, so that it can be compared with the common errors.
+func Join(errs ...error) error {
+	var flat []error
+	for _, err := range errs {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			flat = append(flat, joined.Unwrap()...)
+		} else if err != nil {
+			flat = append(flat, err)
+		}
+	}
+
+	if len(flat) == 1 {
+		return flat[0]
+	}
+
+	return errors.Join(flat...)
+}
@@ -0,0 +1,125 @@
+package rest
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"url-shortner/internal/domain"
+	"url-shortner/internal/domain/validation"
+	"url-shortner/internal/ports/rest/response"
+)
+
+const (
+	// codeValidationFailed is the code of requests with invalid fields, which are listed in errors of the problem
+	codeValidationFailed = "validation_failed"
+	codeInternal         = "internal_error"
+)
+
+// errMalformedBody hides the messages of json decoder, which describe go types rather than the api
+var errMalformedBody = errors.New("request body should be a json object with fields of valid types")
+
+// errBodyTooLarge is returned for bodies, which are longer than any valid request
+var errBodyTooLarge = errors.New("request body is too large")
+
+// apiError describes the response for an error: the status, the stable code and the field of the request it is about
+type apiError struct {
+	err    error
+	status int
+	code   string
+	field  string
+}
+
+// apiErrors maps domain and validation errors to responses
+// Codes are part of the api, so they are never changed. Errors which are not listed are unexpected
+// and respond with 500 Internal Server Error.
+var apiErrors = []apiError{
+	{domain.ErrURLNotFound, http.StatusNotFound, "url_not_found", ""},
+	{domain.ErrCodeMistyped, http.StatusNotFound, "code_mistyped", ""},
+	{domain.ErrURLGone, http.StatusGone, "url_gone", ""},
+	{domain.ErrAliasTaken, http.StatusConflict, "alias_taken", "alias"},
+	{domain.ErrCodeTaken, http.StatusConflict, "code_taken", ""},
+	{domain.ErrCodesExhausted, http.StatusServiceUnavailable, "codes_exhausted", ""},
+
+	{errMalformedBody, http.StatusBadRequest, "malformed_body", ""},
+	{errBodyTooLarge, http.StatusRequestEntityTooLarge, "body_too_large", ""},
+	{errMalformedRecord, http.StatusBadRequest, "malformed_record", ""},
+
+	{validation.ErrInvalidURL, http.StatusBadRequest, "invalid_url", "url"},
+	{validation.ErrInvalidURLLen, http.StatusBadRequest, "invalid_url_length", "url"},
+	{validation.ErrFilteredURL, http.StatusBadRequest, "filtered_url", "url"},
+	{validation.ErrKeywordLength, http.StatusBadRequest, "invalid_alias_length", "alias"},
+	{validation.ErrInvalidKeyword, http.StatusBadRequest, "invalid_alias", "alias"},
+	{validation.ErrReservedAlias, http.StatusBadRequest, "reserved_alias", "alias"},
+	{validation.ErrInvalidDate, http.StatusBadRequest, "invalid_date", "expires_on"},
+	{validation.ErrPastExpiration, http.StatusBadRequest, "past_expiration", "expires_on"},
+	{validation.ErrInvalidRedirect, http.StatusBadRequest, "invalid_redirect_type", "redirect_type"},
+	{validation.ErrInvalidPage, http.StatusBadRequest, "invalid_page", "page"},
+	{validation.ErrInvalidPerPage, http.StatusBadRequest, "invalid_per_page", "per_page"},
+	{validation.ErrInvalidBucket, http.StatusBadRequest, "invalid_interval", "interval"},
+	{validation.ErrInvalidPeriod, http.StatusBadRequest, "invalid_period", "from"},
+	{validation.ErrPeriodTooLong, http.StatusBadRequest, "period_too_long", "from"},
+	{validation.ErrBatchSize, http.StatusBadRequest, "invalid_batch_size", "urls"},
+	{validation.ErrInvalidFormat, http.StatusBadRequest, "invalid_format", "format"},
+	{validation.ErrInvalidCode, http.StatusBadRequest, "invalid_code", "code"},
+	{validation.ErrInvalidClicks, http.StatusBadRequest, "invalid_clicks", "clicks"},
+}
+
+// findAPIError finds the response for the error, which may be wrapped
+func findAPIError(err error) (apiError, bool) {
+	for _, apiErr := range apiErrors {
+		if errors.Is(err, apiErr.err) {
+			return apiErr, true
+		}
+	}
+
+	return apiError{}, false
+}
+
+// translateError builds the problem for an error returned by a service or a validator
+// Joined validation errors are listed per field. It reports false for unexpected errors.
+func translateError(err error) (*response.Problem, bool) {
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+
+	var problem *response.Problem
+	for _, err := range errs {
+		apiErr, ok := findAPIError(err)
+		if !ok {
+			return nil, false
+		}
+
+		if problem == nil {
+			problem = response.NewProblem(apiErr.status, apiErr.code, apiErr.err.Error())
+		}
+
+		if apiErr.field != "" {
+			problem.Errors = append(problem.Errors, response.FieldError{Field: apiErr.field, Code: apiErr.code, Detail: apiErr.err.Error()})
+		}
+	}
+
+	// the invalid fields are told by errors, so that clients check a single code for any invalid request
+	if problem.Status == http.StatusBadRequest && len(problem.Errors) > 0 {
+		problem.Code = codeValidationFailed
+	}
+
+	return problem, true
+}
+
+// respondError writes the problem for an error returned by a service or a validator
+func (h *Handler) respondError(w http.ResponseWriter, err error, message string) {
+	response.ProblemJSON(w, h.problem(err, message))
+}
+
+// problem builds the problem for an error returned by a service or a validator
+// Unexpected errors are logged and described by the given message, so that no internals leak to clients.
+func (h *Handler) problem(err error, message string) *response.Problem {
+	problem, ok := translateError(err)
+	if !ok {
+		h.logger.Error(message, slog.String("error", err.Error()))
+		problem = response.NewProblem(http.StatusInternalServerError, codeInternal, message)
+	}
+
+	return problem
+}
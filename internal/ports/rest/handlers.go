@@ -6,25 +6,50 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
+	"io"
 	"log/slog"
 	"net/http"
+	"time"
 	"url-shortner/internal/domain"
+	"url-shortner/internal/domain/validation"
 	"url-shortner/internal/ports/rest/request"
 	"url-shortner/internal/ports/rest/response"
 )
 
+// maxImportFailures limits the failures reported by an import, the number of failures is still counted
+const maxImportFailures = 1000
+
+// batchItemMaxBytes bounds the json of a single url of a bulk request: the longest url,
+// which may be doubled by escaping, and the other fields
+var batchItemMaxBytes = int64(2*request.URLMaxLength + 512)
+
 type ServiceURLShortener interface {
-	Proxy(ctx context.Context, id int) (string, error)
-	Create(ctx context.Context, url string) (*domain.Link, error)
+	Proxy(ctx context.Context, code string) (*domain.Link, error)
+	Create(ctx context.Context, link *domain.Link) (*domain.Link, error)
+	CreateBatch(ctx context.Context, links []*domain.Link) ([]domain.LinkResult, error)
+	Import(ctx context.Context, links []*domain.Link) ([]domain.LinkResult, error)
+	Export(ctx context.Context, fn func(link *domain.Link) error) error
+	Get(ctx context.Context, code string) (*domain.Link, error)
+	List(ctx context.Context, filter *domain.LinkFilter) ([]*domain.Link, bool, error)
+	Stats(ctx context.Context, code string) (*domain.Link, error)
+	UpdateURL(ctx context.Context, code string, url string) (*domain.Link, error)
+	Delete(ctx context.Context, code string) error
 }
 
+// ServiceEncoder rejects codes which can't be produced by the encoder, before any storage is queried
 type ServiceEncoder interface {
-	Encode(int) string
-	Decode(string) int
+	Decode(code string) (int, error)
+	Normalize(code string) string
+}
+
+type ServiceAnalytics interface {
+	Track(linkID int, referrer, userAgent string)
+	Report(ctx context.Context, filter *domain.ClickFilter) (*domain.ClickReport, error)
 }
 
 type ServiceRender interface {
 	Home(http.ResponseWriter)
+	Mistyped(w http.ResponseWriter, code string)
 	Icon(http.ResponseWriter, *http.Request)
 }
 
@@ -32,15 +57,30 @@ type Handler struct {
 	logger       *slog.Logger
 	urlshortener ServiceURLShortener
 	encoder      ServiceEncoder
-	render       ServiceRender
+	// legacyEncoder produced codes of links created before codes were stored, which keep resolving
+	legacyEncoder ServiceEncoder
+	analytics     ServiceAnalytics
+	render        ServiceRender
+	// redirectType is the status code of redirects for links without own redirect type
+	redirectType int
+	// redirectMaxAge is how long clients may cache permanent redirects
+	redirectMaxAge time.Duration
+	// batchSize is the maximum number of urls created by a single bulk request
+	batchSize int
 }
 
-func NewHandler(logger *slog.Logger, urlshortener ServiceURLShortener, encoder ServiceEncoder, render ServiceRender) *Handler {
+func NewHandler(logger *slog.Logger, urlshortener ServiceURLShortener, encoder, legacyEncoder ServiceEncoder, analytics ServiceAnalytics, render ServiceRender,
+	redirectType int, redirectMaxAge time.Duration, batchSize int) *Handler {
 	return &Handler{
-		logger:       logger,
-		urlshortener: urlshortener,
-		encoder:      encoder,
-		render:       render,
+		logger:         logger,
+		urlshortener:   urlshortener,
+		encoder:        encoder,
+		legacyEncoder:  legacyEncoder,
+		analytics:      analytics,
+		render:         render,
+		redirectType:   redirectType,
+		redirectMaxAge: redirectMaxAge,
+		batchSize:      batchSize,
 	}
 }
 
@@ -53,64 +93,579 @@ func (h *Handler) Icon(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) RegisterURL(w http.ResponseWriter, r *http.Request) {
-	url, err := getUrlFromPayload(r)
+	input, err := getInputFromPayload(r)
+	if err == nil {
+		err = h.validateAlias(input.Alias)
+	}
+
 	if err != nil {
-		response.JSON(w, http.StatusBadRequest, response.Body{"message": err.Error()})
+		h.respondError(w, err, "invalid request")
 		return
 	}
 
 	// check if link already exists on database
-	newLink, err := h.urlshortener.Create(r.Context(), url)
+	newLink, err := h.urlshortener.Create(r.Context(), &domain.Link{
+		URL:          input.URL,
+		Alias:        input.Alias,
+		ExpiresOn:    input.ExpiresAt,
+		RedirectType: input.RedirectType,
+	})
 	if err != nil {
-		h.logger.Error("failed to create short url", slog.String("error", err.Error()))
-		response.JSON(w, http.StatusInternalServerError, response.Body{"message": "failed to create short url"})
+		h.respondError(w, err, "failed to create short url")
 		return
 	}
 
-	shortCode, shortURL := buildShortURL(h.encoder, r.Host, newLink)
-	body := response.Body{"short_code": shortCode, "short_url": shortURL}
-	response.JSON(w, http.StatusOK, body)
+	response.JSON(w, http.StatusOK, buildCreatedBody(r.Host, newLink))
+}
+
+// RegisterURLs creates the urls of a batch, every url is reported by the item of its index.
+// Invalid urls and taken aliases fail only their items, while the other urls are still created.
+func (h *Handler) RegisterURLs(w http.ResponseWriter, r *http.Request) {
+	var batch request.URLBatch
+
+	// the body is limited before decoding, since batches are decoded at once
+	r.Body = http.MaxBytesReader(w, r.Body, int64(h.batchSize)*batchItemMaxBytes)
+
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.respondError(w, errBodyTooLarge, "invalid request")
+			return
+		}
+
+		h.respondError(w, errMalformedBody, "invalid request")
+		return
+	}
+
+	if err := batch.Validate(h.batchSize); err != nil {
+		h.respondError(w, err, "invalid request")
+		return
+	}
+
+	items := make([]response.Body, len(batch.URLs))
+	links := make([]*domain.Link, 0, len(batch.URLs))
+	indexes := make([]int, 0, len(batch.URLs))
+	for i := range batch.URLs {
+		input := &batch.URLs[i]
+		err := input.Validate()
+		if err == nil {
+			err = h.validateAlias(input.Alias)
+		}
+
+		if err != nil {
+			items[i] = buildFailedItem(i, h.problem(err, "failed to create short url"))
+			continue
+		}
+
+		links = append(links, &domain.Link{
+			URL:          input.URL,
+			Alias:        input.Alias,
+			ExpiresOn:    input.ExpiresAt,
+			RedirectType: input.RedirectType,
+		})
+		indexes = append(indexes, i)
+	}
+
+	if len(links) > 0 {
+		results, err := h.urlshortener.CreateBatch(r.Context(), links)
+		if err != nil {
+			h.respondError(w, err, "failed to create short urls")
+			return
+		}
+
+		for n, result := range results {
+			i := indexes[n]
+			if result.Err != nil {
+				items[i] = buildFailedItem(i, h.problem(result.Err, "failed to create short url"))
+				continue
+			}
+
+			items[i] = buildCreatedBody(r.Host, result.Link).Merge(response.Body{"index": i, "status": http.StatusOK})
+		}
+	}
+
+	created := 0
+	for _, item := range items {
+		if item["status"] == http.StatusOK {
+			created++
+		}
+	}
+
+	response.JSON(w, http.StatusOK, response.Body{"items": items, "created": created, "failed": len(items) - created})
 }
 
 func (h *Handler) ProxyURLCode(w http.ResponseWriter, r *http.Request) {
 	code := chi.URLParam(r, "code")
 	if len(code) == 0 {
-		response.JSON(w, http.StatusNotFound, response.Body{"message": "url param 'code' should not be empty"})
+		h.respondError(w, domain.ErrURLNotFound, "failed to proxy url")
+		return
+	}
+
+	_, decodeErr := h.encoder.Decode(code)
+	if !h.mayBeStored(code, decodeErr) {
+		h.respondError(w, domain.ErrURLNotFound, "failed to proxy url")
+		return
+	}
+
+	var link *domain.Link
+	err := h.byCode(r, func(code string) (err error) {
+		link, err = h.urlshortener.Proxy(r.Context(), code)
+		return err
+	})
+	if err != nil {
+		// the code is still looked up, since links created before check digits were enabled don't have them
+		if errors.Is(err, domain.ErrURLNotFound) && errors.Is(decodeErr, domain.ErrCodeMistyped) {
+			h.render.Mistyped(w, code)
+			return
+		}
+
+		h.respondError(w, err, "failed to proxy url")
+		return
+	}
+
+	h.analytics.Track(link.ID, r.Referer(), r.UserAgent())
+
+	h.redirect(w, r, link)
+}
+
+// validateAlias refuses aliases which look like generated codes out of id range,
+// since ProxyURLCode never looks such codes up.
+func (h *Handler) validateAlias(alias string) error {
+	if alias == "" {
+		return nil
+	}
+
+	if _, err := h.encoder.Decode(alias); !h.mayBeStored(alias, err) {
+		return validation.ErrReservedAlias
+	}
+
+	return nil
+}
+
+// validateCode checks the code of an imported record: aliases are checked like on create,
+// other codes should be decoded by the encoder or the legacy one, like exported generated codes are.
+func (h *Handler) validateCode(record *request.LinkRecord) error {
+	if record.Alias != "" {
+		return h.validateAlias(record.Alias)
+	}
+
+	if record.Code == "" {
+		return nil
+	}
+
+	if _, err := h.encoder.Decode(record.Code); err == nil {
+		return nil
+	}
+
+	if _, err := h.legacyEncoder.Decode(record.Code); err == nil {
+		return nil
+	}
+
+	return validation.ErrInvalidCode
+}
+
+// mayBeStored reports whether a link may be stored under the code, given the error of decoding it.
+// Codes which look like generated ones but are out of id range are never stored: aliases like them are refused.
+func (h *Handler) mayBeStored(code string, decodeErr error) bool {
+	if decodeErr == nil {
+		return true
+	}
+
+	// legacy codes may be shorter than aliases and have chars removed from the alphabet since
+	if _, err := h.legacyEncoder.Decode(code); err == nil {
+		return true
+	}
+
+	if errors.Is(decodeErr, domain.ErrCodeOverflow) {
+		return false
+	}
+
+	return request.ValidateKeyword(code) == nil
+}
+
+// byCode calls fn with the code of the request and, if no link has it, with the normalized code.
+// Codes of case-insensitive encoders may be typed in another case, the exact code goes first,
+// since older codes are case-sensitive.
+func (h *Handler) byCode(r *http.Request, fn func(code string) error) error {
+	code := chi.URLParam(r, "code")
+
+	err := fn(code)
+	if normalized := h.encoder.Normalize(code); errors.Is(err, domain.ErrURLNotFound) && normalized != code {
+		err = fn(normalized)
+	}
+
+	return err
+}
+
+func (h *Handler) GetURL(w http.ResponseWriter, r *http.Request) {
+	var link *domain.Link
+	err := h.byCode(r, func(code string) (err error) {
+		link, err = h.urlshortener.Get(r.Context(), code)
+		return err
+	})
+	if err != nil {
+		h.respondError(w, err, "failed to get url")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, buildLinkBody(r.Host, link))
+}
+
+func (h *Handler) URLStats(w http.ResponseWriter, r *http.Request) {
+	var link *domain.Link
+	err := h.byCode(r, func(code string) (err error) {
+		link, err = h.urlshortener.Stats(r.Context(), code)
+		return err
+	})
+	if err != nil {
+		h.respondError(w, err, "failed to get url stats")
+		return
+	}
+
+	shortCode, _ := buildShortURL(r.Host, link)
+	response.JSON(w, http.StatusOK, response.Body{"short_code": shortCode, "clicks": link.Clicks})
+}
+
+func (h *Handler) URLAnalytics(w http.ResponseWriter, r *http.Request) {
+	filter := request.NewClickFilter(r.URL.Query())
+	if err := filter.Validate(time.Now().UTC()); err != nil {
+		h.respondError(w, err, "invalid request")
+		return
+	}
+
+	var link *domain.Link
+	err := h.byCode(r, func(code string) (err error) {
+		link, err = h.urlshortener.Get(r.Context(), code)
+		return err
+	})
+	if err != nil {
+		h.respondError(w, err, "failed to get url analytics")
+		return
+	}
+
+	report, err := h.analytics.Report(r.Context(), filter.ToDomain(link.ID))
+	if err != nil {
+		h.respondError(w, err, "failed to get url analytics")
+		return
+	}
+
+	buckets := make([]response.Body, 0, len(report.Buckets))
+	for _, bucket := range report.Buckets {
+		buckets = append(buckets, response.Body{"time": formatDate(bucket.Time), "clicks": bucket.Clicks})
+	}
+
+	referrers := make([]response.Body, 0, len(report.TopReferrers))
+	for _, referrer := range report.TopReferrers {
+		referrers = append(referrers, response.Body{"referrer": referrer.Referrer, "clicks": referrer.Clicks})
+	}
+
+	shortCode, _ := buildShortURL(r.Host, link)
+	response.JSON(w, http.StatusOK, response.Body{
+		"short_code":    shortCode,
+		"interval":      filter.Interval,
+		"from":          formatDate(filter.FromTime),
+		"to":            formatDate(filter.ToTime),
+		"buckets":       buckets,
+		"top_referrers": referrers,
+		"bot_clicks":    report.BotClicks,
+	})
+}
+
+func (h *Handler) ListURLs(w http.ResponseWriter, r *http.Request) {
+	filter := request.NewURLFilter(r.URL.Query())
+	if err := filter.Validate(); err != nil {
+		h.respondError(w, err, "invalid request")
+		return
+	}
+
+	links, hasNext, err := h.urlshortener.List(r.Context(), filter.ToDomain())
+	if err != nil {
+		h.respondError(w, err, "failed to list urls")
+		return
+	}
+
+	items := make([]response.Body, 0, len(links))
+	for _, link := range links {
+		items = append(items, buildLinkBody(r.Host, link))
+	}
+
+	response.JSON(w, http.StatusOK, response.Paginated(items, filter.PageNum, filter.Limit, hasNext))
+}
+
+func (h *Handler) UpdateURL(w http.ResponseWriter, r *http.Request) {
+	var input request.URLUpdate
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		h.respondError(w, errMalformedBody, "invalid request")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		h.respondError(w, err, "invalid request")
+		return
+	}
+
+	var link *domain.Link
+	err := h.byCode(r, func(code string) (err error) {
+		link, err = h.urlshortener.UpdateURL(r.Context(), code, input.URL)
+		return err
+	})
+	if err != nil {
+		h.respondError(w, err, "failed to update url")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, buildLinkBody(r.Host, link))
+}
+
+func (h *Handler) DeleteURL(w http.ResponseWriter, r *http.Request) {
+	err := h.byCode(r, func(code string) error {
+		return h.urlshortener.Delete(r.Context(), code)
+	})
+	if err != nil {
+		h.respondError(w, err, "failed to delete url")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// redirect sends the client to the destination of the link.
+// Permanent redirects may be cached by clients until the link expires, temporary ones are never cached,
+// so that every click is tracked and changed destinations are followed.
+func (h *Handler) redirect(w http.ResponseWriter, r *http.Request, link *domain.Link) {
+	status := link.RedirectType
+	if status == 0 {
+		status = h.redirectType
+	}
+
+	switch status {
+	case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		maxAge := h.redirectMaxAge
+		if link.ExpiresOn != nil {
+			maxAge = max(0, min(maxAge, time.Until(*link.ExpiresOn)))
+		}
+
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
+	default:
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+
+	http.Redirect(w, r, link.URL, status)
+}
+
+// ExportURLs streams all links as csv or ndjson, links are never held in memory at once.
+func (h *Handler) ExportURLs(w http.ResponseWriter, r *http.Request) {
+	format, err := request.ValidateFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		h.respondError(w, err, "invalid request")
+		return
+	}
+
+	// exports outlast the server timeouts, the error is ignored for writers which don't support deadlines
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", recordContentTypes[format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"links.%s\"", format))
+
+	writer := newRecordWriter(format, w)
+
+	written := 0
+	err = h.urlshortener.Export(r.Context(), func(link *domain.Link) error {
+		written++
+		return writer.Write(request.NewLinkRecord(link))
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if err == nil {
+		return
+	}
+
+	// nothing is sent before the first link, so the error can still be responded
+	if written == 0 {
+		w.Header().Del("Content-Disposition")
+		h.respondError(w, err, "failed to export urls")
+		return
+	}
+
+	// the status is already sent, aborting the response tells clients that the export is incomplete
+	h.logger.Error("failed to export urls", slog.String("error", err.Error()), slog.Int("written", written))
+	panic(http.ErrAbortHandler)
+}
+
+// ImportURLs reads links as csv or ndjson and stores them in batches under their own codes, links without code get generated ones.
+// Conflicting codes and invalid records fail only themselves and are reported by their lines.
+// If the import stops after some links are stored, the report of them is responded along with the error.
+func (h *Handler) ImportURLs(w http.ResponseWriter, r *http.Request) {
+	format, err := request.ValidateFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		h.respondError(w, err, "invalid request")
 		return
 	}
 
-	id := h.encoder.Decode(code)
+	// imports outlast the server timeouts, the errors are ignored for writers which don't support deadlines
+	controller := http.NewResponseController(w)
+	_ = controller.SetReadDeadline(time.Time{})
+	_ = controller.SetWriteDeadline(time.Time{})
 
-	link, err := h.urlshortener.Proxy(r.Context(), id)
+	reader, err := newRecordReader(format, r.Body)
 	if err != nil {
-		if errors.Is(err, domain.ErrURLNotFound) {
-			response.JSON(w, http.StatusNotFound, response.Body{"message": err.Error()})
+		h.respondError(w, err, "invalid request")
+		return
+	}
+
+	imported, failed := 0, 0
+	failures := make([]response.Body, 0)
+	fail := func(line int, problem *response.Problem) {
+		failed++
+		if len(failures) < maxImportFailures {
+			failures = append(failures, response.Body{"line": line, "status": problem.Status, "error": problem})
+		}
+	}
+
+	// links of earlier batches are already stored, so clients learn which of them to skip on retry
+	abort := func(err error, message string) {
+		if imported == 0 {
+			h.respondError(w, err, message)
 			return
 		}
 
-		h.logger.Error("failed to proxy url", slog.String("error", err.Error()))
-		response.JSON(w, http.StatusInternalServerError, response.Body{"message": "failed to proxy url"})
+		problem := h.problem(err, message)
+		response.JSON(w, problem.Status, response.Body{"imported": imported, "failed": failed, "failures": failures, "error": problem})
+	}
+
+	links := make([]*domain.Link, 0, h.batchSize)
+	lines := make([]int, 0, h.batchSize)
+	importBatch := func() error {
+		if len(links) == 0 {
+			return nil
+		}
+
+		results, err := h.urlshortener.Import(r.Context(), links)
+		if err != nil {
+			return err
+		}
+
+		for n, result := range results {
+			if result.Err != nil {
+				fail(lines[n], h.problem(result.Err, "failed to import url"))
+				continue
+			}
+
+			imported++
+		}
 
+		links, lines = links[:0], lines[:0]
+		return nil
 	}
 
-	http.Redirect(w, r, link, http.StatusMovedPermanently)
+	for {
+		record, line, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if errors.Is(err, errMalformedRecord) {
+			fail(line, h.problem(err, "failed to import url"))
+			continue
+		}
+
+		if err != nil {
+			h.logger.Warn("failed to read import", slog.String("error", err.Error()), slog.Int("imported", imported))
+			abort(errMalformedBody, "invalid request")
+			return
+		}
+
+		err = record.Validate()
+		if err == nil {
+			err = h.validateCode(record)
+		}
+
+		if err != nil {
+			fail(line, h.problem(err, "failed to import url"))
+			continue
+		}
+
+		links = append(links, record.ToDomain())
+		lines = append(lines, line)
+
+		if len(links) == h.batchSize {
+			if err := importBatch(); err != nil {
+				abort(err, "failed to import urls")
+				return
+			}
+		}
+	}
+
+	if err := importBatch(); err != nil {
+		abort(err, "failed to import urls")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, response.Body{"imported": imported, "failed": failed, "failures": failures})
 }
 
-func getUrlFromPayload(r *http.Request) (string, error) {
+func getInputFromPayload(r *http.Request) (*request.URLInput, error) {
 	var input request.URLInput
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		return "", err
+		return nil, errMalformedBody
 	}
 
 	if err := input.Validate(); err != nil {
-		return "", err
+		return nil, err
+	}
+
+	return &input, nil
+}
+
+func buildShortURL(host string, link *domain.Link) (string, string) {
+	return link.Code, fmt.Sprintf("http://%s/%s", host, link.Code)
+}
+
+// buildCreatedBody builds the response for a created link
+func buildCreatedBody(host string, link *domain.Link) response.Body {
+	shortCode, shortURL := buildShortURL(host, link)
+
+	body := response.Body{"short_code": shortCode, "short_url": shortURL}
+	if link.ExpiresOn != nil {
+		body["expires_on"] = formatDate(*link.ExpiresOn)
+	}
+
+	return body
+}
+
+// buildFailedItem builds the item of a batch response for a link which is not created
+func buildFailedItem(index int, problem *response.Problem) response.Body {
+	return response.Body{"index": index, "status": problem.Status, "error": problem}
+}
+
+// buildLinkBody builds the link metadata returned by the management api
+func buildLinkBody(host string, link *domain.Link) response.Body {
+	shortCode, shortURL := buildShortURL(host, link)
+
+	body := response.Body{
+		"short_code":    shortCode,
+		"short_url":     shortURL,
+		"url":           link.URL,
+		"alias":         link.Alias,
+		"expires_on":    nil,
+		"redirect_type": nil,
+	}
+
+	if link.ExpiresOn != nil {
+		body["expires_on"] = formatDate(*link.ExpiresOn)
+	}
+
+	if link.RedirectType != 0 {
+		body["redirect_type"] = link.RedirectType
 	}
 
-	return input.URL, nil
+	return body
 }
 
-func buildShortURL(encoder ServiceEncoder, host string, link *domain.Link) (string, string) {
-	code := encoder.Encode(link.ID)
-	return code, fmt.Sprintf("http://%s/%s", host, code)
+func formatDate(t time.Time) string {
+	return t.UTC().Format(request.DateLayout)
 }
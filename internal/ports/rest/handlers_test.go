@@ -0,0 +1,766 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"url-shortner/internal/domain"
+	"url-shortner/internal/domain/validation"
+	"url-shortner/internal/ports/rest/response"
+	"url-shortner/pkg/logger/slogdiscard"
+)
+
+var errStorage = errors.New("connection refused")
+
+// fakeShortener serves the links it holds, or fails every call with err
+type fakeShortener struct {
+	links    map[string]*domain.Link
+	err      error
+	proxied  []string
+	imported []*domain.Link
+	// importErr fails imports once some links are imported
+	importErr error
+}
+
+func (s *fakeShortener) find(code string) (*domain.Link, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	link, ok := s.links[code]
+	if !ok {
+		return nil, domain.ErrURLNotFound
+	}
+
+	return link, nil
+}
+
+func (s *fakeShortener) Proxy(_ context.Context, code string) (*domain.Link, error) {
+	s.proxied = append(s.proxied, code)
+	return s.find(code)
+}
+
+func (s *fakeShortener) Create(_ context.Context, link *domain.Link) (*domain.Link, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	created := *link
+	created.Code = "created"
+	return &created, nil
+}
+
+// CreateBatch fails links with the alias "taken", like the alias were used by another link
+func (s *fakeShortener) CreateBatch(_ context.Context, links []*domain.Link) ([]domain.LinkResult, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	results := make([]domain.LinkResult, 0, len(links))
+	for i, link := range links {
+		if link.Alias == "taken" {
+			results = append(results, domain.LinkResult{Err: domain.ErrAliasTaken})
+			continue
+		}
+
+		created := *link
+		created.Code = fmt.Sprintf("created%d", i)
+		results = append(results, domain.LinkResult{Link: &created})
+	}
+
+	return results, nil
+}
+
+// Import fails links with the code "taken", like the code were used by another link
+func (s *fakeShortener) Import(_ context.Context, links []*domain.Link) ([]domain.LinkResult, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	if s.importErr != nil && len(s.imported) > 0 {
+		return nil, s.importErr
+	}
+
+	results := make([]domain.LinkResult, 0, len(links))
+	for _, link := range links {
+		if link.Code == "taken" {
+			results = append(results, domain.LinkResult{Err: domain.ErrCodeTaken})
+			continue
+		}
+
+		s.imported = append(s.imported, link)
+		results = append(results, domain.LinkResult{Link: link})
+	}
+
+	return results, nil
+}
+
+func (s *fakeShortener) Export(_ context.Context, fn func(link *domain.Link) error) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	codes := make([]string, 0, len(s.links))
+	for code := range s.links {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+
+	for _, code := range codes {
+		if err := fn(s.links[code]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *fakeShortener) Get(_ context.Context, code string) (*domain.Link, error) {
+	return s.find(code)
+}
+
+func (s *fakeShortener) List(context.Context, *domain.LinkFilter) ([]*domain.Link, bool, error) {
+	if s.err != nil {
+		return nil, false, s.err
+	}
+
+	links := make([]*domain.Link, 0, len(s.links))
+	for _, link := range s.links {
+		links = append(links, link)
+	}
+
+	return links, false, nil
+}
+
+func (s *fakeShortener) Stats(_ context.Context, code string) (*domain.Link, error) {
+	return s.find(code)
+}
+
+func (s *fakeShortener) UpdateURL(_ context.Context, code string, url string) (*domain.Link, error) {
+	link, err := s.find(code)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *link
+	updated.URL = url
+	return &updated, nil
+}
+
+func (s *fakeShortener) Delete(_ context.Context, code string) error {
+	_, err := s.find(code)
+	return err
+}
+
+// fakeEncoder accepts every code except the listed ones, and normalizes codes to lower case
+// The legacy codes are only accepted by the legacy encoder of the test server.
+type fakeEncoder struct {
+	invalid map[string]error
+	legacy  []string
+}
+
+func (e fakeEncoder) Decode(code string) (int, error) {
+	if err, ok := e.invalid[code]; ok {
+		return 0, err
+	}
+
+	return 1, nil
+}
+
+func (e fakeEncoder) Normalize(code string) string {
+	return strings.ToLower(code)
+}
+
+// fakeLegacyEncoder accepts the listed codes only
+type fakeLegacyEncoder struct {
+	codes []string
+}
+
+func (e fakeLegacyEncoder) Decode(code string) (int, error) {
+	if !slices.Contains(e.codes, code) {
+		return 0, errors.New("invalid char")
+	}
+
+	return 1, nil
+}
+
+func (e fakeLegacyEncoder) Normalize(code string) string {
+	return code
+}
+
+type fakeAnalytics struct {
+	tracked []int
+}
+
+func (a *fakeAnalytics) Track(linkID int, _, _ string) {
+	a.tracked = append(a.tracked, linkID)
+}
+
+func (a *fakeAnalytics) Report(_ context.Context, filter *domain.ClickFilter) (*domain.ClickReport, error) {
+	return &domain.ClickReport{}, nil
+}
+
+type fakeRender struct {
+	mistyped []string
+}
+
+func (r *fakeRender) Home(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func (r *fakeRender) Mistyped(w http.ResponseWriter, code string) {
+	r.mistyped = append(r.mistyped, code)
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (r *fakeRender) Icon(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+type testServer struct {
+	router    *chi.Mux
+	shortener *fakeShortener
+	analytics *fakeAnalytics
+	render    *fakeRender
+}
+
+func newTestServer(shortener *fakeShortener, encoder fakeEncoder) *testServer {
+	server := &testServer{shortener: shortener, analytics: &fakeAnalytics{}, render: &fakeRender{}}
+	handler := NewHandler(slogdiscard.NewDiscardLogger(), shortener, encoder, fakeLegacyEncoder{codes: encoder.legacy}, server.analytics, server.render, http.StatusFound, time.Hour, 3)
+
+	server.router = chi.NewRouter()
+	server.router.Get("/{code}", handler.ProxyURLCode)
+	server.router.Post("/api/urls", handler.RegisterURL)
+	server.router.Post("/api/urls/batch", handler.RegisterURLs)
+	server.router.Get("/api/urls/export", handler.ExportURLs)
+	server.router.Post("/api/urls/import", handler.ImportURLs)
+	server.router.Get("/api/urls/{code}", handler.GetURL)
+	server.router.Patch("/api/urls/{code}", handler.UpdateURL)
+	server.router.Delete("/api/urls/{code}", handler.DeleteURL)
+	server.router.Get("/api/urls/{code}/stats", handler.URLStats)
+	server.router.Get("/api/urls/{code}/analytics", handler.URLAnalytics)
+
+	return server
+}
+
+func (s *testServer) serve(method, target, body string) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	s.router.ServeHTTP(res, httptest.NewRequest(method, target, strings.NewReader(body)))
+
+	return res
+}
+
+func problem(t *testing.T, res *httptest.ResponseRecorder) *response.Problem {
+	assert.Equal(t, response.ProblemContentType, res.Header().Get("Content-Type"))
+
+	var problem response.Problem
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &problem))
+
+	return &problem
+}
+
+func TestHandler_ProxyURLCode(t *testing.T) {
+	links := map[string]*domain.Link{
+		"abc":       {ID: 1, Code: "abc", URL: "https://example.com/temporary"},
+		"permanent": {ID: 2, Code: "permanent", URL: "https://example.com/permanent", RedirectType: http.StatusMovedPermanently},
+	}
+
+	testCases := []struct {
+		name         string
+		code         string
+		err          error
+		invalid      map[string]error
+		status       int
+		location     string
+		cacheControl string
+		errorCode    string
+		tracked      []int
+		mistyped     []string
+	}{
+		{
+			name:         "default redirect",
+			code:         "abc",
+			status:       http.StatusFound,
+			location:     "https://example.com/temporary",
+			cacheControl: "private, no-store",
+			tracked:      []int{1},
+		},
+		{
+			name:         "permanent redirect",
+			code:         "permanent",
+			status:       http.StatusMovedPermanently,
+			location:     "https://example.com/permanent",
+			cacheControl: "public, max-age=3600",
+			tracked:      []int{2},
+		},
+		{
+			name:     "normalized code",
+			code:     "ABC",
+			status:   http.StatusFound,
+			location: "https://example.com/temporary",
+			tracked:  []int{1},
+		},
+		{
+			name:      "not found",
+			code:      "missing",
+			status:    http.StatusNotFound,
+			errorCode: "url_not_found",
+		},
+		{
+			name:      "gone",
+			code:      "abc",
+			err:       domain.ErrURLGone,
+			status:    http.StatusGone,
+			errorCode: "url_gone",
+		},
+		{
+			name:      "storage failure",
+			code:      "abc",
+			err:       errStorage,
+			status:    http.StatusInternalServerError,
+			errorCode: "internal_error",
+		},
+		{
+			name:      "invalid code",
+			code:      "a.b",
+			invalid:   map[string]error{"a.b": errors.New("invalid char")},
+			status:    http.StatusNotFound,
+			errorCode: "url_not_found",
+		},
+		{
+			name:     "mistyped code",
+			code:     "abd",
+			invalid:  map[string]error{"abd": domain.ErrCodeMistyped},
+			status:   http.StatusNotFound,
+			mistyped: []string{"abd"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(&fakeShortener{links: links, err: tc.err}, fakeEncoder{invalid: tc.invalid})
+
+			res := server.serve(http.MethodGet, "/"+tc.code, "")
+
+			assert.Equal(t, tc.status, res.Code)
+			assert.Equal(t, tc.location, res.Header().Get("Location"))
+			if tc.cacheControl != "" {
+				assert.Equal(t, tc.cacheControl, res.Header().Get("Cache-Control"))
+			}
+			if tc.errorCode != "" {
+				assert.Equal(t, tc.errorCode, problem(t, res).Code)
+			}
+			assert.Equal(t, tc.tracked, server.analytics.tracked)
+			assert.Equal(t, tc.mistyped, server.render.mistyped)
+		})
+	}
+}
+
+func TestHandler_ProxyURLCode_InvalidCodeSkipsLookup(t *testing.T) {
+	testCases := []struct {
+		name    string
+		code    string
+		err     error
+		legacy  []string
+		proxied []string
+	}{
+		{"invalid char", "a.b", errors.New("invalid char"), nil, nil},
+		{"overflowing code", "99999999999", domain.ErrCodeOverflow, nil, nil},
+		// aliases with chars out of the alphabet fail to decode
+		{"alias", "launch-2026", errors.New("invalid char"), nil, []string{"launch-2026"}},
+		// the char of the legacy code was removed from the alphabet, and the code is too short for an alias
+		{"legacy code", "0", errors.New("invalid char"), []string{"0"}, []string{"0"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(&fakeShortener{}, fakeEncoder{invalid: map[string]error{tc.code: tc.err}, legacy: tc.legacy})
+
+			res := server.serve(http.MethodGet, "/"+tc.code, "")
+
+			assert.Equal(t, http.StatusNotFound, res.Code)
+			assert.Equal(t, tc.proxied, server.shortener.proxied)
+		})
+	}
+}
+
+func TestHandler_ReservedAliasIsRefused(t *testing.T) {
+	// the alias looks like a code out of id range, which the redirect never looks up
+	const alias = "99999999999"
+	shortener := &fakeShortener{}
+	server := newTestServer(shortener, fakeEncoder{invalid: map[string]error{alias: domain.ErrCodeOverflow}})
+
+	res := server.serve(http.MethodPost, "/api/urls", `{"url": "https://example.com/new", "alias": "`+alias+`"}`)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, "reserved_alias", problem(t, res).Errors[0].Code)
+
+	res = server.serve(http.MethodPost, "/api/urls/batch", `{"urls": [{"url": "https://example.com/new", "alias": "`+alias+`"}]}`)
+	assert.Contains(t, res.Body.String(), "reserved_alias")
+
+	res = server.serve(http.MethodPost, "/api/urls/import", `{"url": "https://example.com/new", "alias": "`+alias+`"}`)
+	assert.Contains(t, res.Body.String(), "reserved_alias")
+
+	// codes without alias should be decoded as generated ones
+	res = server.serve(http.MethodPost, "/api/urls/import", `{"url": "https://example.com/new", "code": "`+alias+`"}`)
+	assert.Contains(t, res.Body.String(), "invalid_code")
+	assert.Empty(t, shortener.imported)
+
+	res = server.serve(http.MethodGet, "/"+alias, "")
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.Empty(t, shortener.proxied)
+
+	// aliases which decode to ids in range may still be created
+	res = server.serve(http.MethodPost, "/api/urls", `{"url": "https://example.com/new", "alias": "launch2026"}`)
+	assert.Equal(t, http.StatusOK, res.Code)
+}
+
+func TestHandler_ErrorMapping(t *testing.T) {
+	links := map[string]*domain.Link{
+		"abc": {ID: 1, Code: "abc", URL: "https://example.com/page"},
+	}
+
+	testCases := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		err    error
+		status int
+		code   string
+	}{
+		{"create", http.MethodPost, "/api/urls", `{"url": "https://example.com/new"}`, nil, http.StatusOK, ""},
+		{"create invalid", http.MethodPost, "/api/urls", `{"url": "nope"}`, nil, http.StatusBadRequest, "validation_failed"},
+		{"create malformed", http.MethodPost, "/api/urls", `{"url": 1}`, nil, http.StatusBadRequest, "malformed_body"},
+		{"create alias taken", http.MethodPost, "/api/urls", `{"url": "https://example.com/new", "alias": "taken"}`,
+			domain.ErrAliasTaken, http.StatusConflict, "alias_taken"},
+		{"create codes exhausted", http.MethodPost, "/api/urls", `{"url": "https://example.com/new"}`,
+			domain.ErrCodesExhausted, http.StatusServiceUnavailable, "codes_exhausted"},
+		{"create failure", http.MethodPost, "/api/urls", `{"url": "https://example.com/new"}`,
+			errStorage, http.StatusInternalServerError, "internal_error"},
+		{"get", http.MethodGet, "/api/urls/abc", "", nil, http.StatusOK, ""},
+		{"get not found", http.MethodGet, "/api/urls/missing", "", nil, http.StatusNotFound, "url_not_found"},
+		{"get normalized", http.MethodGet, "/api/urls/ABC", "", nil, http.StatusOK, ""},
+		{"get wrapped not found", http.MethodGet, "/api/urls/abc", "", fmt.Errorf("storage.pg.GetByCode: %w", domain.ErrURLNotFound),
+			http.StatusNotFound, "url_not_found"},
+		{"get failure", http.MethodGet, "/api/urls/abc", "", errStorage, http.StatusInternalServerError, "internal_error"},
+		{"stats normalized", http.MethodGet, "/api/urls/ABC/stats", "", nil, http.StatusOK, ""},
+		{"stats not found", http.MethodGet, "/api/urls/missing/stats", "", nil, http.StatusNotFound, "url_not_found"},
+		{"stats failure", http.MethodGet, "/api/urls/abc/stats", "", errStorage, http.StatusInternalServerError, "internal_error"},
+		{"analytics", http.MethodGet, "/api/urls/abc/analytics?interval=hour", "", nil, http.StatusOK, ""},
+		{"analytics period too long", http.MethodGet, "/api/urls/abc/analytics?interval=hour&from=2000-01-01%2000:00:00", "",
+			nil, http.StatusBadRequest, "validation_failed"},
+		{"update", http.MethodPatch, "/api/urls/abc", `{"url": "https://example.com/other"}`, nil, http.StatusOK, ""},
+		{"update normalized", http.MethodPatch, "/api/urls/ABC", `{"url": "https://example.com/other"}`, nil, http.StatusOK, ""},
+		{"update not found", http.MethodPatch, "/api/urls/missing", `{"url": "https://example.com/other"}`,
+			nil, http.StatusNotFound, "url_not_found"},
+		{"update failure", http.MethodPatch, "/api/urls/abc", `{"url": "https://example.com/other"}`,
+			errStorage, http.StatusInternalServerError, "internal_error"},
+		{"delete", http.MethodDelete, "/api/urls/abc", "", nil, http.StatusNoContent, ""},
+		{"delete normalized", http.MethodDelete, "/api/urls/ABC", "", nil, http.StatusNoContent, ""},
+		{"delete not found", http.MethodDelete, "/api/urls/missing", "", nil, http.StatusNotFound, "url_not_found"},
+		{"delete failure", http.MethodDelete, "/api/urls/abc", "", errStorage, http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(&fakeShortener{links: links, err: tc.err}, fakeEncoder{})
+
+			res := server.serve(tc.method, tc.target, tc.body)
+
+			assert.Equal(t, tc.status, res.Code)
+			if tc.code != "" {
+				assert.Equal(t, tc.code, problem(t, res).Code)
+			}
+		})
+	}
+}
+
+func TestHandler_ValidationProblem(t *testing.T) {
+	server := newTestServer(&fakeShortener{}, fakeEncoder{})
+
+	res := server.serve(http.MethodPost, "/api/urls", `{"url": "nope", "alias": "a", "redirect_type": 200}`)
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	p := problem(t, res)
+	assert.Equal(t, "validation_failed", p.Code)
+	assert.Equal(t, []response.FieldError{
+		{Field: "url", Code: "invalid_url_length", Detail: validation.ErrInvalidURLLen.Error()},
+		{Field: "alias", Code: "invalid_alias_length", Detail: validation.ErrKeywordLength.Error()},
+		{Field: "redirect_type", Code: "invalid_redirect_type", Detail: validation.ErrInvalidRedirect.Error()},
+	}, p.Errors)
+}
+
+func TestHandler_MalformedBodyHidesDecoderError(t *testing.T) {
+	server := newTestServer(&fakeShortener{}, fakeEncoder{})
+
+	res := server.serve(http.MethodPost, "/api/urls", `{"url": 1}`)
+
+	p := problem(t, res)
+	assert.Equal(t, errMalformedBody.Error(), p.Detail)
+	assert.NotContains(t, res.Body.String(), "Go struct")
+}
+
+func TestHandler_RegisterURLs(t *testing.T) {
+	server := newTestServer(&fakeShortener{}, fakeEncoder{})
+
+	res := server.serve(http.MethodPost, "/api/urls/batch", `{"urls": [
+		{"url": "https://example.com/first"},
+		{"url": "nope"},
+		{"url": "https://example.com/second", "alias": "taken"}
+	]}`)
+	require.Equal(t, http.StatusOK, res.Code)
+
+	var body struct {
+		Items []struct {
+			Index     int               `json:"index"`
+			Status    int               `json:"status"`
+			ShortCode string            `json:"short_code"`
+			Error     *response.Problem `json:"error"`
+		} `json:"items"`
+		Created int `json:"created"`
+		Failed  int `json:"failed"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+
+	require.Len(t, body.Items, 3)
+	assert.Equal(t, 1, body.Created)
+	assert.Equal(t, 2, body.Failed)
+
+	assert.Equal(t, http.StatusOK, body.Items[0].Status)
+	assert.Equal(t, "created0", body.Items[0].ShortCode)
+
+	assert.Equal(t, 1, body.Items[1].Index)
+	assert.Equal(t, http.StatusBadRequest, body.Items[1].Status)
+	assert.Equal(t, "validation_failed", body.Items[1].Error.Code)
+
+	assert.Equal(t, http.StatusConflict, body.Items[2].Status)
+	assert.Equal(t, "alias_taken", body.Items[2].Error.Code)
+}
+
+func TestHandler_RegisterURLsErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+		code   string
+	}{
+		{"malformed", `{"urls": {}}`, nil, http.StatusBadRequest, "malformed_body"},
+		{"empty", `{"urls": []}`, nil, http.StatusBadRequest, "validation_failed"},
+		{"too large", `{"urls": [{}, {}, {}, {}]}`, nil, http.StatusBadRequest, "validation_failed"},
+		{"body too large", `{"urls": [{"url": "https://example.com/` + strings.Repeat("a", 1<<20) + `"}]}`,
+			nil, http.StatusRequestEntityTooLarge, "body_too_large"},
+		{"failure", `{"urls": [{"url": "https://example.com/first"}]}`, errStorage, http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newTestServer(&fakeShortener{err: tc.err}, fakeEncoder{})
+
+			res := server.serve(http.MethodPost, "/api/urls/batch", tc.body)
+
+			assert.Equal(t, tc.status, res.Code)
+			assert.Equal(t, tc.code, problem(t, res).Code)
+		})
+	}
+}
+
+func TestHandler_ExportURLs(t *testing.T) {
+	expiresOn := time.Date(2026, 12, 31, 23, 59, 59, 0, time.UTC)
+	links := map[string]*domain.Link{
+		"abc":    {ID: 1, Code: "abc", URL: "https://example.com/page", Clicks: 5},
+		"launch": {ID: 2, Code: "launch", URL: "https://example.com/launch", Alias: "launch", ExpiresOn: &expiresOn, RedirectType: 301},
+	}
+
+	testCases := []struct {
+		format      string
+		contentType string
+		body        string
+	}{
+		{"csv", "text/csv", "code,url,alias,expires_on,redirect_type,clicks\n" +
+			"abc,https://example.com/page,,,,5\n" +
+			"launch,https://example.com/launch,launch,2026-12-31 23:59:59,301,0\n"},
+		{"ndjson", "application/x-ndjson", `{"code":"abc","url":"https://example.com/page","clicks":5}` + "\n" +
+			`{"code":"launch","url":"https://example.com/launch","alias":"launch","expires_on":"2026-12-31 23:59:59","redirect_type":301,"clicks":0}` + "\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			server := newTestServer(&fakeShortener{links: links}, fakeEncoder{})
+
+			res := server.serve(http.MethodGet, "/api/urls/export?format="+tc.format, "")
+
+			assert.Equal(t, http.StatusOK, res.Code)
+			assert.Equal(t, tc.contentType, res.Header().Get("Content-Type"))
+			assert.Equal(t, tc.body, res.Body.String())
+		})
+	}
+}
+
+func TestHandler_ExportURLsErrors(t *testing.T) {
+	server := newTestServer(&fakeShortener{}, fakeEncoder{})
+	res := server.serve(http.MethodGet, "/api/urls/export?format=xml", "")
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, "validation_failed", problem(t, res).Code)
+
+	server = newTestServer(&fakeShortener{err: errStorage}, fakeEncoder{})
+	res = server.serve(http.MethodGet, "/api/urls/export", "")
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+	assert.Equal(t, "internal_error", problem(t, res).Code)
+	assert.Empty(t, res.Header().Get("Content-Disposition"))
+}
+
+func TestHandler_ImportURLs(t *testing.T) {
+	testCases := []struct {
+		format string
+		body   string
+		lines  []int
+	}{
+		{"csv", "url,code,clicks\n" +
+			"https://example.com/first,old1,10\n" +
+			"https://example.com/second,taken,0\n" +
+			"nope,old3,0\n" +
+			"https://example.com/fourth,old4,many\n" +
+			"https://example.com/fifth,,\n", []int{3, 4, 5}},
+		{"ndjson", `{"url": "https://example.com/first", "code": "old1", "clicks": 10}` + "\n" +
+			`{"url": "https://example.com/second", "code": "taken"}` + "\n" +
+			`{"url": "nope", "code": "old3"}` + "\n" +
+			`{"url": "https://example.com/fourth", "code": "old4", "clicks": "many"}` + "\n" +
+			"\n" +
+			`{"url": "https://example.com/fifth"}` + "\n", []int{2, 3, 4}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			shortener := &fakeShortener{}
+			server := newTestServer(shortener, fakeEncoder{})
+
+			res := server.serve(http.MethodPost, "/api/urls/import?format="+tc.format, tc.body)
+			require.Equal(t, http.StatusOK, res.Code)
+
+			var body struct {
+				Imported int `json:"imported"`
+				Failed   int `json:"failed"`
+				Failures []struct {
+					Line  int               `json:"line"`
+					Error *response.Problem `json:"error"`
+				} `json:"failures"`
+			}
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &body))
+
+			assert.Equal(t, 2, body.Imported)
+			assert.Equal(t, 3, body.Failed)
+
+			codes := make([]string, 0, len(body.Failures))
+			lines := make([]int, 0, len(body.Failures))
+			for _, failure := range body.Failures {
+				codes = append(codes, failure.Error.Code)
+				lines = append(lines, failure.Line)
+			}
+			slices.Sort(codes)
+			slices.Sort(lines)
+			assert.Equal(t, []string{"code_taken", "malformed_record", "validation_failed"}, codes)
+			assert.Equal(t, tc.lines, lines)
+
+			require.Len(t, shortener.imported, 2)
+			assert.Equal(t, "old1", shortener.imported[0].Code)
+			assert.Equal(t, int64(10), shortener.imported[0].Clicks)
+			assert.Empty(t, shortener.imported[1].Code)
+		})
+	}
+}
+
+func TestHandler_ImportClicksWithoutCode(t *testing.T) {
+	shortener := &fakeShortener{}
+	server := newTestServer(shortener, fakeEncoder{})
+
+	// links without code may be deduplicated into existing ones, which would lose the clicks
+	res := server.serve(http.MethodPost, "/api/urls/import", `{"url": "https://example.com/new", "clicks": 3}`)
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Contains(t, res.Body.String(), "invalid_clicks")
+	assert.Empty(t, shortener.imported)
+
+	res = server.serve(http.MethodPost, "/api/urls/import", `{"url": "https://example.com/new", "alias": "launch", "clicks": 3}`)
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Len(t, shortener.imported, 1)
+	assert.Equal(t, int64(3), shortener.imported[0].Clicks)
+}
+
+func TestHandler_ExportImportRoundTrip(t *testing.T) {
+	// generated codes may be a single char, which is too short for an alias
+	links := map[string]*domain.Link{
+		"b":      {ID: 1, Code: "b", URL: "https://example.com/page", Clicks: 5},
+		"launch": {ID: 2, Code: "launch", URL: "https://example.com/launch", Alias: "launch"},
+	}
+
+	for _, format := range []string{"csv", "ndjson"} {
+		t.Run(format, func(t *testing.T) {
+			shortener := &fakeShortener{links: links}
+			server := newTestServer(shortener, fakeEncoder{})
+
+			exported := server.serve(http.MethodGet, "/api/urls/export?format="+format, "")
+			require.Equal(t, http.StatusOK, exported.Code)
+
+			res := server.serve(http.MethodPost, "/api/urls/import?format="+format, exported.Body.String())
+			require.Equal(t, http.StatusOK, res.Code)
+
+			var report struct {
+				Imported int `json:"imported"`
+				Failed   int `json:"failed"`
+			}
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &report))
+
+			assert.Equal(t, 2, report.Imported)
+			assert.Equal(t, 0, report.Failed)
+			require.Len(t, shortener.imported, 2)
+			assert.Equal(t, "b", shortener.imported[0].Code)
+			assert.Equal(t, int64(5), shortener.imported[0].Clicks)
+		})
+	}
+}
+
+func TestHandler_ImportURLsPartial(t *testing.T) {
+	shortener := &fakeShortener{importErr: errStorage}
+	server := newTestServer(shortener, fakeEncoder{})
+
+	// the second batch fails after the first one of three links is imported
+	body := `{"url": "https://example.com/first", "code": "old1"}` + "\n" +
+		`{"url": "https://example.com/second", "code": "taken"}` + "\n" +
+		`{"url": "https://example.com/third", "code": "old3"}` + "\n" +
+		`{"url": "https://example.com/fourth", "code": "old4"}` + "\n"
+
+	res := server.serve(http.MethodPost, "/api/urls/import", body)
+	require.Equal(t, http.StatusInternalServerError, res.Code)
+
+	var report struct {
+		Imported int               `json:"imported"`
+		Failed   int               `json:"failed"`
+		Error    *response.Problem `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &report))
+
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, "internal_error", report.Error.Code)
+	assert.Len(t, shortener.imported, 2)
+}
+
+func TestHandler_ImportURLsMalformed(t *testing.T) {
+	server := newTestServer(&fakeShortener{}, fakeEncoder{})
+
+	res := server.serve(http.MethodPost, "/api/urls/import?format=csv", "code,destination\nabc,https://example.com/page\n")
+
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.Equal(t, "malformed_body", problem(t, res).Code)
+}
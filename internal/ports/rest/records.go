@@ -0,0 +1,192 @@
+package rest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"url-shortner/internal/ports/rest/request"
+)
+
+// maxRecordSize limits a line of imported ndjson
+const maxRecordSize = 1 << 20
+
+// errMalformedRecord fails a single record of an import, the records after it are still read
+var errMalformedRecord = errors.New("record should be a csv row matching the header or a json object with fields of valid types")
+
+var recordContentTypes = map[string]string{
+	request.FormatCSV:    "text/csv",
+	request.FormatNDJSON: "application/x-ndjson",
+}
+
+// recordReader reads the links of an import one by one
+// Read returns the number of the line the record starts at, errMalformedRecord for a record which can't be parsed
+// and io.EOF after the last record. Other errors mean that the rest of the import can't be read.
+type recordReader interface {
+	Read() (*request.LinkRecord, int, error)
+}
+
+// recordWriter writes the links of an export one by one, records may be buffered until Flush
+type recordWriter interface {
+	Write(record *request.LinkRecord) error
+	Flush() error
+}
+
+func newRecordReader(format string, r io.Reader) (recordReader, error) {
+	if format == request.FormatCSV {
+		return newCSVRecordReader(r)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+
+	return &ndjsonRecordReader{scanner: scanner}, nil
+}
+
+func newRecordWriter(format string, w io.Writer) recordWriter {
+	if format == request.FormatCSV {
+		writer := csv.NewWriter(w)
+		_ = writer.Write(request.RecordColumns)
+
+		return &csvRecordWriter{writer: writer}
+	}
+
+	return &ndjsonRecordWriter{encoder: json.NewEncoder(w)}
+}
+
+// csvRecordReader reads rows by the columns of the header, so that columns may go in any order and unknown ones are skipped
+type csvRecordReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVRecordReader(r io.Reader) (*csvRecordReader, error) {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err != nil || !slices.Contains(header, "url") {
+		return nil, errMalformedBody
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[column] = i
+	}
+
+	return &csvRecordReader{reader: reader, columns: columns}, nil
+}
+
+func (c *csvRecordReader) Read() (*request.LinkRecord, int, error) {
+	row, err := c.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, parseErr.StartLine, errMalformedRecord
+		}
+
+		return nil, 0, err
+	}
+
+	line, _ := c.reader.FieldPos(0)
+
+	column := func(name string) string {
+		if i, ok := c.columns[name]; ok {
+			return row[i]
+		}
+
+		return ""
+	}
+
+	record := &request.LinkRecord{
+		Code:      column("code"),
+		URL:       column("url"),
+		Alias:     column("alias"),
+		ExpiresOn: column("expires_on"),
+	}
+
+	if value := column("redirect_type"); value != "" {
+		record.RedirectType, err = strconv.Atoi(value)
+		if err != nil {
+			return nil, line, errMalformedRecord
+		}
+	}
+
+	if value := column("clicks"); value != "" {
+		record.Clicks, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, line, errMalformedRecord
+		}
+	}
+
+	return record, line, nil
+}
+
+// ndjsonRecordReader reads a json object per line, blank lines are skipped
+type ndjsonRecordReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (n *ndjsonRecordReader) Read() (*request.LinkRecord, int, error) {
+	for n.scanner.Scan() {
+		n.line++
+
+		if len(n.scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record request.LinkRecord
+		if err := json.Unmarshal(n.scanner.Bytes(), &record); err != nil {
+			return nil, n.line, errMalformedRecord
+		}
+
+		return &record, n.line, nil
+	}
+
+	if err := n.scanner.Err(); err != nil {
+		return nil, n.line + 1, err
+	}
+
+	return nil, n.line, io.EOF
+}
+
+type csvRecordWriter struct {
+	writer *csv.Writer
+}
+
+func (c *csvRecordWriter) Write(record *request.LinkRecord) error {
+	redirectType := ""
+	if record.RedirectType != 0 {
+		redirectType = strconv.Itoa(record.RedirectType)
+	}
+
+	return c.writer.Write([]string{
+		record.Code,
+		record.URL,
+		record.Alias,
+		record.ExpiresOn,
+		redirectType,
+		strconv.FormatInt(record.Clicks, 10),
+	})
+}
+
+func (c *csvRecordWriter) Flush() error {
+	c.writer.Flush()
+
+	return c.writer.Error()
+}
+
+type ndjsonRecordWriter struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonRecordWriter) Write(record *request.LinkRecord) error {
+	return n.encoder.Encode(record)
+}
+
+func (n *ndjsonRecordWriter) Flush() error {
+	return nil
+}
@@ -0,0 +1,97 @@
+package request
+
+import (
+	"net/url"
+	"time"
+	"url-shortner/internal/domain"
+	"url-shortner/internal/domain/validation"
+)
+
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+)
+
+// default report periods per interval
+var defaultPeriods = map[string]time.Duration{
+	IntervalHour: 24 * time.Hour,
+	IntervalDay:  30 * 24 * time.Hour,
+}
+
+// longest report periods per interval, so that a report scans a bounded number of partitions and returns a bounded number of buckets
+var maxPeriods = map[string]time.Duration{
+	IntervalHour: 31 * 24 * time.Hour,
+	IntervalDay:  366 * 24 * time.Hour,
+}
+
+// ClickFilter defines structure for click analytics request
+type ClickFilter struct {
+	Interval string    `json:"interval"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	FromTime time.Time `json:"-"`
+	ToTime   time.Time `json:"-"`
+}
+
+// NewClickFilter builds the filter from query string of analytics request
+func NewClickFilter(query url.Values) *ClickFilter {
+	return &ClickFilter{
+		Interval: query.Get("interval"),
+		From:     query.Get("from"),
+		To:       query.Get("to"),
+	}
+}
+
+// Validate validates the filter and parses the period
+// Period defaults to the last day for hourly and to the last month for daily buckets,
+// it may be at most 31 days for hourly and 366 days for daily buckets.
+func (filter *ClickFilter) Validate(now time.Time) error {
+	if filter.Interval == "" {
+		filter.Interval = IntervalDay
+	}
+
+	period, ok := defaultPeriods[filter.Interval]
+	if !ok {
+		return validation.ErrInvalidBucket
+	}
+
+	filter.ToTime = now
+	if filter.To != "" {
+		to, err := time.Parse(DateLayout, filter.To)
+		if err != nil {
+			return validation.ErrInvalidPeriod
+		}
+
+		filter.ToTime = to
+	}
+
+	filter.FromTime = filter.ToTime.Add(-period)
+	if filter.From != "" {
+		from, err := time.Parse(DateLayout, filter.From)
+		if err != nil {
+			return validation.ErrInvalidPeriod
+		}
+
+		filter.FromTime = from
+	}
+
+	if !filter.FromTime.Before(filter.ToTime) {
+		return validation.ErrInvalidPeriod
+	}
+
+	if filter.ToTime.Sub(filter.FromTime) > maxPeriods[filter.Interval] {
+		return validation.ErrPeriodTooLong
+	}
+
+	return nil
+}
+
+// ToDomain converts the validated filter to domain.ClickFilter
+func (filter *ClickFilter) ToDomain(linkID int) *domain.ClickFilter {
+	return &domain.ClickFilter{
+		LinkID:   linkID,
+		Interval: filter.Interval,
+		From:     filter.FromTime,
+		To:       filter.ToTime,
+	}
+}
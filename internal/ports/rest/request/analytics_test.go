@@ -0,0 +1,39 @@
+package request
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+	"time"
+	"url-shortner/internal/domain/validation"
+)
+
+func TestClickFilter_Validate(t *testing.T) {
+	now := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	filter := NewClickFilter(url.Values{"interval": {"hour"}})
+	assert.NoError(t, filter.Validate(now))
+	assert.Equal(t, now.Add(-24*time.Hour), filter.FromTime)
+	assert.Equal(t, now, filter.ToTime)
+
+	filter = NewClickFilter(url.Values{"from": {"2026-01-01 00:00:00"}, "to": {"2026-01-02 00:00:00"}})
+	assert.NoError(t, filter.Validate(now))
+	assert.Equal(t, IntervalDay, filter.Interval)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), filter.FromTime)
+
+	assert.Equal(t, validation.ErrInvalidBucket, NewClickFilter(url.Values{"interval": {"week"}}).Validate(now))
+	assert.Equal(t, validation.ErrInvalidPeriod, NewClickFilter(url.Values{"from": {"2026-02-01 00:00:00"}}).Validate(now))
+
+	// reports are limited to 31 days of hours and 366 days of days
+	filter = NewClickFilter(url.Values{"interval": {"hour"}, "from": {"2025-12-31 12:00:00"}})
+	assert.NoError(t, filter.Validate(now))
+
+	filter = NewClickFilter(url.Values{"interval": {"hour"}, "from": {"2025-12-31 11:59:59"}})
+	assert.Equal(t, validation.ErrPeriodTooLong, filter.Validate(now))
+
+	filter = NewClickFilter(url.Values{"from": {"2025-01-31 12:00:00"}})
+	assert.NoError(t, filter.Validate(now))
+
+	filter = NewClickFilter(url.Values{"from": {"2000-01-01 00:00:00"}})
+	assert.Equal(t, validation.ErrPeriodTooLong, filter.Validate(now))
+}
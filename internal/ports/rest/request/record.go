@@ -0,0 +1,100 @@
+package request
+
+import (
+	"time"
+	"url-shortner/internal/domain"
+	"url-shortner/internal/domain/validation"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// RecordColumns are the columns of exported and imported csv files
+var RecordColumns = []string{"code", "url", "alias", "expires_on", "redirect_type", "clicks"}
+
+// LinkRecord defines structure for a link of export and import
+type LinkRecord struct {
+	Code         string     `json:"code"`
+	URL          string     `json:"url"`
+	Alias        string     `json:"alias,omitempty"`
+	ExpiresOn    string     `json:"expires_on,omitempty"`
+	RedirectType int        `json:"redirect_type,omitempty"`
+	Clicks       int64      `json:"clicks"`
+	ExpiresAt    *time.Time `json:"-"`
+}
+
+// ValidateFormat validates the format of export and import, which defaults to ndjson
+// It returns the format or error if the format is unknown.
+func ValidateFormat(format string) (string, error) {
+	switch format {
+	case "":
+		return FormatNDJSON, nil
+	case FormatCSV, FormatNDJSON:
+		return format, nil
+	default:
+		return "", validation.ErrInvalidFormat
+	}
+}
+
+// NewLinkRecord builds the record of an exported link
+func NewLinkRecord(link *domain.Link) *LinkRecord {
+	record := &LinkRecord{
+		Code:         link.Code,
+		URL:          link.URL,
+		Alias:        link.Alias,
+		RedirectType: link.RedirectType,
+		Clicks:       link.Clicks,
+	}
+
+	if link.ExpiresOn != nil {
+		record.ExpiresOn = link.ExpiresOn.UTC().Format(DateLayout)
+	}
+
+	return record
+}
+
+// Validate validates the imported record like URLInput
+// The code defaults to the alias, since aliases are codes themselves, records without both get generated codes.
+// Codes without alias are generated ones, which may be shorter than aliases, so their format is left to decoders.
+// Links without code may be deduplicated into existing ones, so their clicks would be lost and are refused.
+// It returns error if something is not valid, errors of several fields are joined.
+func (record *LinkRecord) Validate() error {
+	input := URLInput{URL: record.URL, Alias: record.Alias, RedirectType: record.RedirectType}
+	errs := []error{input.Validate()}
+
+	// exported links may have expired since, they are imported as expired rather than failed
+	if record.ExpiresOn != "" {
+		expiresAt, err := time.Parse(DateLayout, record.ExpiresOn)
+		if err != nil {
+			errs = append(errs, validation.ErrInvalidDate)
+		} else {
+			record.ExpiresAt = &expiresAt
+		}
+	}
+
+	if record.Code == "" {
+		record.Code = record.Alias
+	} else if record.Alias != "" && record.Code != record.Alias {
+		errs = append(errs, validation.ErrInvalidCode)
+	}
+
+	if record.Clicks < 0 || (record.Clicks > 0 && record.Code == "") {
+		errs = append(errs, validation.ErrInvalidClicks)
+	}
+
+	return validation.Join(errs...)
+}
+
+// ToDomain converts the validated record to domain.Link
+func (record *LinkRecord) ToDomain() *domain.Link {
+	return &domain.Link{
+		Code:         record.Code,
+		URL:          record.URL,
+		Alias:        record.Alias,
+		ExpiresOn:    record.ExpiresAt,
+		RedirectType: record.RedirectType,
+		Clicks:       record.Clicks,
+	}
+}
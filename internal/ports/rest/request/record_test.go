@@ -0,0 +1,61 @@
+package request
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"url-shortner/internal/domain/validation"
+)
+
+func TestLinkRecord_Validate(t *testing.T) {
+	record := LinkRecord{URL: "https://example.com/page", Alias: "launch"}
+	assert.NoError(t, record.Validate())
+	assert.Equal(t, "launch", record.Code)
+
+	record = LinkRecord{URL: "https://example.com/page"}
+	assert.NoError(t, record.Validate())
+	assert.Empty(t, record.Code)
+
+	record = LinkRecord{URL: "https://example.com/page", ExpiresOn: "2020-01-02 03:04:05"}
+	assert.NoError(t, record.Validate())
+	assert.Equal(t, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), *record.ExpiresAt)
+
+	record = LinkRecord{URL: "https://example.com/page", ExpiresOn: "tomorrow"}
+	assert.ErrorIs(t, record.Validate(), validation.ErrInvalidDate)
+
+	// generated codes may be shorter than aliases, they are checked by decoders
+	record = LinkRecord{URL: "https://example.com/page", Code: "b"}
+	assert.NoError(t, record.Validate())
+
+	record = LinkRecord{URL: "https://example.com/page", Code: "abc", Alias: "launch"}
+	assert.Equal(t, validation.ErrInvalidCode, record.Validate())
+
+	// links with generated codes may be deduplicated, which would lose their clicks
+	record = LinkRecord{URL: "https://example.com/page", Clicks: 5}
+	assert.Equal(t, validation.ErrInvalidClicks, record.Validate())
+
+	record = LinkRecord{URL: "https://example.com/page", Alias: "launch", Clicks: 5}
+	assert.NoError(t, record.Validate())
+
+	record = LinkRecord{URL: "https://example.com/page", Code: "b", Clicks: -1}
+	assert.Equal(t, validation.ErrInvalidClicks, record.Validate())
+
+	record = LinkRecord{URL: "nope", Code: "abc", Alias: "launch", RedirectType: 200}
+	err := record.Validate()
+	assert.ErrorIs(t, err, validation.ErrInvalidURLLen)
+	assert.ErrorIs(t, err, validation.ErrInvalidRedirect)
+	assert.ErrorIs(t, err, validation.ErrInvalidCode)
+}
+
+func TestValidateFormat(t *testing.T) {
+	format, err := ValidateFormat("")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatNDJSON, format)
+
+	format, err = ValidateFormat(FormatCSV)
+	assert.NoError(t, err)
+	assert.Equal(t, FormatCSV, format)
+
+	_, err = ValidateFormat("xml")
+	assert.Equal(t, validation.ErrInvalidFormat, err)
+}
@@ -2,22 +2,47 @@ package request
 
 import (
 	"net"
+	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"url-shortner/internal/domain"
 	"url-shortner/internal/domain/validation"
 )
 
 // URLInput defines structure for create short code url request
 type URLInput struct {
-	URL  string `json:"url" binding:"required"`
-	Host string `json:"-"`
+	URL          string     `json:"url" binding:"required"`
+	Alias        string     `json:"alias"`
+	ExpiresOn    string     `json:"expires_on"`
+	RedirectType int        `json:"redirect_type"`
+	Host         string     `json:"-"`
+	ExpiresAt    *time.Time `json:"-"`
+}
+
+// URLUpdate defines structure for change destination of short code url request
+type URLUpdate struct {
+	URL string `json:"url" binding:"required"`
+}
+
+// URLBatch defines structure for bulk create short code urls request
+type URLBatch struct {
+	URLs []URLInput `json:"urls"`
 }
 
 // URLFilter defines structure for short code list and search request
 type URLFilter struct {
 	ShortCode string `json:"short_code"`
 	Keyword   string `json:"keyword"`
+	URL       string `json:"url"`
+	Host      string `json:"host"`
 	Page      string `json:"page"`
+	PerPage   string `json:"per_page"`
+	PageNum   int    `json:"-"`
+	Limit     int    `json:"-"`
 }
 
 // @see https://github.com/asaskevich/govalidator/blob/master/patterns.go
@@ -34,16 +59,59 @@ var (
 	URLMaxLength   = 2048
 	URLRegex       = `^` + URLSchema + `?` + URLUsername + `?` + `((` + URLIP + `|(\[` + IP + `\])|(([a-zA-Z0-9]([a-zA-Z0-9-_]+)?[a-zA-Z0-9]([-\.][a-zA-Z0-9]+)*)|(` + URLSubdomain + `?))?(([a-zA-Z\x{00a1}-\x{ffff}0-9]+-?-?)*[a-zA-Z\x{00a1}-\x{ffff}0-9]+)(?:\.([a-zA-Z\x{00a1}-\x{ffff}]{1,}))?))\.?` + URLPort + `?` + URLPath + `?$`
 	URLFilterRegex = `(xxx|localhost|127\.0\.0\.1|\.local)`
+
+	KeywordMinLength = 2
+	KeywordMaxLength = 25
+	KeywordRegex     = `^[a-zA-Z0-9_-]+$`
+
+	DateLayout = "2006-01-02 15:04:05"
+
+	DefaultPerPage = 20
+	MaxPerPage     = 100
+
+	RedirectTypes = []int{http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect}
 )
 
 var (
-	urlRe    = regexp.MustCompile(URLRegex)
-	filterRe = regexp.MustCompile(URLFilterRegex)
+	urlRe     = regexp.MustCompile(URLRegex)
+	filterRe  = regexp.MustCompile(URLFilterRegex)
+	keywordRe = regexp.MustCompile(KeywordRegex)
 )
 
 // Validate validates the url input before saving to db
-// It returns error if something is not valid.
+// It returns error if something is not valid, errors of several fields are joined.
 func (input *URLInput) Validate() error {
+	var errs []error
+	if err := input.validateURL(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if input.Alias != "" {
+		if err := ValidateKeyword(input.Alias); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if input.ExpiresOn != "" {
+		expiresAt, err := ParseExpiration(input.ExpiresOn, time.Now())
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			input.ExpiresAt = &expiresAt
+		}
+	}
+
+	if input.RedirectType != 0 {
+		if err := ValidateRedirectType(input.RedirectType); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return validation.Join(errs...)
+}
+
+// validateURL validates the url and extracts its host
+func (input *URLInput) validateURL() error {
 	if l := len(input.URL); l < URLMinLength || l > URLMaxLength {
 		return validation.ErrInvalidURLLen
 	}
@@ -68,3 +136,112 @@ func (input *URLInput) Validate() error {
 
 	return nil
 }
+
+// ValidateRedirectType validates the status code of a redirect
+// It returns error if the status code is not a redirect status which keeps the link a link.
+func ValidateRedirectType(redirectType int) error {
+	if !slices.Contains(RedirectTypes, redirectType) {
+		return validation.ErrInvalidRedirect
+	}
+
+	return nil
+}
+
+// ParseExpiration parses expires_on value given in UTC
+// It returns error if the date is malformed or is not in the future.
+func ParseExpiration(expiresOn string, now time.Time) (time.Time, error) {
+	expiresAt, err := time.Parse(DateLayout, expiresOn)
+	if err != nil {
+		return time.Time{}, validation.ErrInvalidDate
+	}
+
+	if !expiresAt.After(now) {
+		return time.Time{}, validation.ErrPastExpiration
+	}
+
+	return expiresAt, nil
+}
+
+// Validate validates the new destination url before saving to db
+// It returns error if something is not valid.
+func (input *URLUpdate) Validate() error {
+	urlInput := URLInput{URL: input.URL}
+
+	return urlInput.Validate()
+}
+
+// Validate validates the size of the batch, its items are validated one by one,
+// so that valid items are created even if others are not.
+func (batch *URLBatch) Validate(maxSize int) error {
+	if l := len(batch.URLs); l == 0 || l > maxSize {
+		return validation.ErrBatchSize
+	}
+
+	return nil
+}
+
+// NewURLFilter builds the filter from query string of list request
+func NewURLFilter(query url.Values) *URLFilter {
+	return &URLFilter{
+		ShortCode: query.Get("short_code"),
+		Keyword:   query.Get("keyword"),
+		URL:       query.Get("url"),
+		Host:      query.Get("host"),
+		Page:      query.Get("page"),
+		PerPage:   query.Get("per_page"),
+	}
+}
+
+// Validate validates the filter and parses pagination params
+// It returns error if something is not valid, errors of several params are joined.
+func (filter *URLFilter) Validate() error {
+	var errs []error
+
+	filter.PageNum = 1
+	if filter.Page != "" {
+		page, err := strconv.Atoi(filter.Page)
+		if err != nil || page < 1 {
+			errs = append(errs, validation.ErrInvalidPage)
+		} else {
+			filter.PageNum = page
+		}
+	}
+
+	filter.Limit = DefaultPerPage
+	if filter.PerPage != "" {
+		perPage, err := strconv.Atoi(filter.PerPage)
+		if err != nil || perPage < 1 || perPage > MaxPerPage {
+			errs = append(errs, validation.ErrInvalidPerPage)
+		} else {
+			filter.Limit = perPage
+		}
+	}
+
+	return validation.Join(errs...)
+}
+
+// ToDomain converts the validated filter to domain.LinkFilter
+func (filter *URLFilter) ToDomain() *domain.LinkFilter {
+	return &domain.LinkFilter{
+		CodePrefix: filter.ShortCode,
+		URL:        filter.URL,
+		Host:       strings.ToLower(filter.Host),
+		Keyword:    filter.Keyword,
+		Offset:     (filter.PageNum - 1) * filter.Limit,
+		Limit:      filter.Limit,
+	}
+}
+
+// ValidateKeyword validates a custom alias (keyword) used as short code
+// It returns error if the keyword is too short, too long or has invalid chars.
+func ValidateKeyword(keyword string) error {
+	if l := len(keyword); l < KeywordMinLength || l > KeywordMaxLength {
+		return validation.ErrKeywordLength
+	}
+
+	if !keywordRe.MatchString(keyword) {
+		return validation.ErrInvalidKeyword
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package request
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"url-shortner/internal/domain/validation"
+)
+
+func TestURLInput_ValidateAlias(t *testing.T) {
+	testCases := map[string]error{
+		"":                                  nil,
+		"launch-2026":                       nil,
+		"my_link":                           nil,
+		"a":                                 validation.ErrKeywordLength,
+		"this-alias-is-way-too-long-to-use": validation.ErrKeywordLength,
+		"bad alias":                         validation.ErrInvalidKeyword,
+		"naïve":                             validation.ErrInvalidKeyword,
+	}
+
+	for alias, expectedErr := range testCases {
+		input := URLInput{URL: "https://example.com/page", Alias: alias}
+		assert.Equal(t, expectedErr, input.Validate(), alias)
+	}
+}
+
+func TestURLInput_ValidateRedirectType(t *testing.T) {
+	testCases := map[int]error{
+		0:   nil,
+		301: nil,
+		302: nil,
+		307: nil,
+		308: nil,
+		200: validation.ErrInvalidRedirect,
+		303: validation.ErrInvalidRedirect,
+	}
+
+	for redirectType, expectedErr := range testCases {
+		input := URLInput{URL: "https://example.com/page", RedirectType: redirectType}
+		assert.Equal(t, expectedErr, input.Validate(), redirectType)
+	}
+}
+
+func TestURLInput_ValidateFields(t *testing.T) {
+	input := URLInput{URL: "not a url", Alias: "a", ExpiresOn: "tomorrow", RedirectType: 200}
+
+	err := input.Validate()
+	assert.ErrorIs(t, err, validation.ErrInvalidURLLen)
+	assert.ErrorIs(t, err, validation.ErrKeywordLength)
+	assert.ErrorIs(t, err, validation.ErrInvalidDate)
+	assert.ErrorIs(t, err, validation.ErrInvalidRedirect)
+}
+
+func TestURLInput_ValidateLength(t *testing.T) {
+	prefix := "https://example.com/"
+
+	input := URLInput{URL: prefix + strings.Repeat("a", URLMaxLength-len(prefix))}
+	assert.NoError(t, input.Validate())
+
+	input = URLInput{URL: prefix + strings.Repeat("a", URLMaxLength-len(prefix)+1)}
+	assert.Equal(t, validation.ErrInvalidURLLen, input.Validate())
+}
+
+func TestParseExpiration(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	expiresAt, err := ParseExpiration("2026-01-02 00:00:00", now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), expiresAt)
+
+	_, err = ParseExpiration("2026-01-01 11:59:59", now)
+	assert.Equal(t, validation.ErrPastExpiration, err)
+
+	_, err = ParseExpiration("02.01.2026", now)
+	assert.Equal(t, validation.ErrInvalidDate, err)
+}
+
+func TestURLFilter_Validate(t *testing.T) {
+	filter := NewURLFilter(url.Values{"page": {"3"}, "per_page": {"10"}, "host": {"Example.COM"}})
+	assert.NoError(t, filter.Validate())
+
+	linkFilter := filter.ToDomain()
+	assert.Equal(t, 20, linkFilter.Offset)
+	assert.Equal(t, 10, linkFilter.Limit)
+	assert.Equal(t, "example.com", linkFilter.Host)
+
+	filter = NewURLFilter(url.Values{})
+	assert.NoError(t, filter.Validate())
+	assert.Equal(t, 1, filter.PageNum)
+	assert.Equal(t, DefaultPerPage, filter.Limit)
+
+	assert.Equal(t, validation.ErrInvalidPage, NewURLFilter(url.Values{"page": {"0"}}).Validate())
+	assert.Equal(t, validation.ErrInvalidPerPage, NewURLFilter(url.Values{"per_page": {"1000"}}).Validate())
+
+	err := NewURLFilter(url.Values{"page": {"0"}, "per_page": {"1000"}}).Validate()
+	assert.ErrorIs(t, err, validation.ErrInvalidPage)
+	assert.ErrorIs(t, err, validation.ErrInvalidPerPage)
+}
@@ -18,6 +18,23 @@ func (body Body) Merge(other Body) Body {
 	return body
 }
 
+// Paginated builds Body for a page of items
+// It reports the next page number or nil if the page is the last one.
+func Paginated(items interface{}, page, perPage int, hasNext bool) Body {
+	body := Body{
+		"items":     items,
+		"page":      page,
+		"per_page":  perPage,
+		"next_page": nil,
+	}
+
+	if hasNext {
+		body["next_page"] = page + 1
+	}
+
+	return body
+}
+
 // JSON is handy shortcut for serving json response
 // It writes header, status and Body to the given http.ResponseWriter.
 func JSON(res http.ResponseWriter, status int, body Body) {
@@ -45,3 +45,21 @@ func TestBody_Merge(t *testing.T) {
 		}
 	})
 }
+
+func TestPaginated(t *testing.T) {
+	t.Run("has next page", func(t *testing.T) {
+		body := Paginated([]string{"a", "b"}, 2, 2, true)
+
+		if val := body["next_page"]; val != 3 {
+			t.Errorf("Paginated must point to the next page, got %v", val)
+		}
+	})
+
+	t.Run("last page", func(t *testing.T) {
+		body := Paginated([]string{"a"}, 2, 2, false)
+
+		if val, ok := body["next_page"]; !ok || val != nil {
+			t.Errorf("Paginated must set next_page to nil on the last page, got %v", val)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ProblemContentType is the media type of error responses, see RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// Problem is the error response following RFC 7807
+// Code is the stable machine-readable error code, Errors lists invalid fields of the request.
+type Problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Code   string       `json:"code"`
+	Detail string       `json:"detail,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes an invalid field of the request
+type FieldError struct {
+	Field  string `json:"field"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+// NewProblem builds the problem of the given status
+// The type is about:blank, since problems are told apart by codes, so the title is the status text.
+func NewProblem(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// ProblemJSON serves the problem as application/problem+json
+// It fills the type and the title, which are not specific to the problem.
+func ProblemJSON(res http.ResponseWriter, problem *Problem) {
+	if problem.Type == "" {
+		problem.Type = "about:blank"
+	}
+
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+
+	res.Header().Set("Content-Type", ProblemContentType)
+	res.WriteHeader(problem.Status)
+
+	_ = json.NewEncoder(res).Encode(problem)
+}
@@ -0,0 +1,34 @@
+package response
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProblemJSON(t *testing.T) {
+	t.Run("problem", func(t *testing.T) {
+		res := httptest.NewRecorder()
+
+		ProblemJSON(res, &Problem{Status: 400, Code: "validation_failed", Errors: []FieldError{{Field: "url", Code: "invalid_url"}}})
+
+		if val := res.Header().Get("Content-Type"); val != ProblemContentType {
+			t.Errorf("ProblemJSON must set problem content type, got %v", val)
+		}
+
+		var actual Problem
+		_ = json.Unmarshal(res.Body.Bytes(), &actual)
+
+		if actual.Type != "about:blank" || actual.Title != "Bad Request" {
+			t.Errorf("ProblemJSON must fill type and title, got %v and %v", actual.Type, actual.Title)
+		}
+
+		if actual.Status != 400 || res.Code != 400 {
+			t.Errorf("ProblemJSON must keep status, got %v", actual.Status)
+		}
+
+		if len(actual.Errors) != 1 || actual.Errors[0].Field != "url" {
+			t.Errorf("ProblemJSON must keep field errors, got %v", actual.Errors)
+		}
+	})
+}
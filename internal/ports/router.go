@@ -2,6 +2,7 @@ package ports
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -11,18 +12,32 @@ import (
 	"time"
 	"url-shortner/internal/config"
 	"url-shortner/internal/ports/rest"
+	"url-shortner/internal/ports/rest/request"
 	mwlogger "url-shortner/pkg/logger/middleware"
 	"url-shortner/pkg/rate_limiter"
 )
 
 type Server struct {
-	logger          *slog.Logger
-	server          *http.Server
+	logger *slog.Logger
+	server *http.Server
+	// adminServer serves the api listing and changing all links apart from the public one, it is nil if disabled
+	adminServer *http.Server
+	// debugServer serves internal counters apart from the api, it is nil if disabled
+	debugServer     *http.Server
 	shutDownTimeout time.Duration
 }
 
-func NewServer(config *config.HTTPConfig, logger *slog.Logger, serviceURLShortener rest.ServiceURLShortener, serviceEncoder rest.ServiceEncoder, serviceRender rest.ServiceRender) (*Server, error) {
-	httpHandler := rest.NewHandler(logger, serviceURLShortener, serviceEncoder, serviceRender)
+func NewServer(config *config.HTTPConfig, logger *slog.Logger, serviceURLShortener rest.ServiceURLShortener, serviceEncoder, legacyEncoder rest.ServiceEncoder, serviceAnalytics rest.ServiceAnalytics, serviceRender rest.ServiceRender) (*Server, error) {
+	if err := request.ValidateRedirectType(config.RedirectType); err != nil {
+		return nil, fmt.Errorf("ports.NewServer: %w", err)
+	}
+
+	if config.BatchSize <= 0 {
+		return nil, fmt.Errorf("ports.NewServer: batch size should be positive, got %d", config.BatchSize)
+	}
+
+	httpHandler := rest.NewHandler(logger, serviceURLShortener, serviceEncoder, legacyEncoder, serviceAnalytics, serviceRender,
+		config.RedirectType, config.RedirectMaxAge, config.BatchSize)
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%s", config.Port),
@@ -31,8 +46,30 @@ func NewServer(config *config.HTTPConfig, logger *slog.Logger, serviceURLShorten
 		WriteTimeout: config.WriteTimeout,
 	}
 
+	var adminServer *http.Server
+	if config.AdminAddr != "" {
+		adminServer = &http.Server{
+			Addr:         config.AdminAddr,
+			Handler:      InitAdminRouter(httpHandler, logger),
+			ReadTimeout:  config.ReadTimeout,
+			WriteTimeout: config.WriteTimeout,
+		}
+	}
+
+	var debugServer *http.Server
+	if config.DebugAddr != "" {
+		debugServer = &http.Server{
+			Addr:         config.DebugAddr,
+			Handler:      InitDebugRouter(),
+			ReadTimeout:  config.ReadTimeout,
+			WriteTimeout: config.WriteTimeout,
+		}
+	}
+
 	return &Server{
 		server:          server,
+		adminServer:     adminServer,
+		debugServer:     debugServer,
 		shutDownTimeout: config.ShutdownTimeout,
 		logger:          logger,
 	}, nil
@@ -43,7 +80,7 @@ func InitRouter(handler *rest.Handler, logger *slog.Logger, limiter *config.Limi
 
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
 		AllowCredentials: true,
 		MaxAge:           300, // максимальный срок кэширования предварительных запросов
@@ -57,17 +94,51 @@ func InitRouter(handler *rest.Handler, logger *slog.Logger, limiter *config.Limi
 	mux.Get("/favicon.ico", handler.Icon)
 	mux.Get("/{code}", handler.ProxyURLCode)
 	mux.Post("/api/urls", handler.RegisterURL)
+	mux.Post("/api/urls/batch", handler.RegisterURLs)
+	mux.Get("/api/urls/{code}", handler.GetURL)
+	mux.Get("/api/urls/{code}/stats", handler.URLStats)
+	mux.Get("/api/urls/{code}/analytics", handler.URLAnalytics)
+
+	return mux
+}
+
+// InitAdminRouter serves the api which lists all links or changes links of others,
+// so it is only served on the internal address, codes can't be enumerated through the public router
+func InitAdminRouter(handler *rest.Handler, logger *slog.Logger) *chi.Mux {
+	mux := chi.NewRouter()
+
+	mux.Use(middleware.Recoverer)
+	mux.Use(mwlogger.Log(logger))
+
+	mux.Get("/api/urls", handler.ListURLs)
+	mux.Get("/api/urls/export", handler.ExportURLs)
+	mux.Post("/api/urls/import", handler.ImportURLs)
+	mux.Patch("/api/urls/{code}", handler.UpdateURL)
+	mux.Delete("/api/urls/{code}", handler.DeleteURL)
+
+	return mux
+}
+
+// InitDebugRouter serves expvar, which exposes the command line and memory stats,
+// so it is only served on the internal address
+func InitDebugRouter() *chi.Mux {
+	mux := chi.NewRouter()
+
+	mux.Handle("/debug/vars", expvar.Handler())
 
 	return mux
 }
 
 func (s *Server) Run(ctx context.Context) error {
-	errResult := make(chan error)
-	go func() {
-		s.logger.Info(fmt.Sprintf("starting listening: %s", s.server.Addr))
+	servers := s.servers()
+	errResult := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *http.Server) {
+			s.logger.Info(fmt.Sprintf("starting listening: %s", server.Addr))
 
-		errResult <- s.server.ListenAndServe()
-	}()
+			errResult <- server.ListenAndServe()
+		}(server)
+	}
 
 	var err error
 	select {
@@ -82,8 +153,22 @@ func (s *Server) Run(ctx context.Context) error {
 func (s *Server) Stop() {
 	ctx, cancel := context.WithTimeout(context.Background(), s.shutDownTimeout)
 	defer cancel()
-	err := s.server.Shutdown(ctx)
-	if err != nil {
-		s.logger.Error("failed to shutdown HTTP Server", slog.String("error", err.Error()))
+
+	for _, server := range s.servers() {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			s.logger.Error("failed to shutdown HTTP Server", slog.String("addr", server.Addr), slog.String("error", err.Error()))
+		}
 	}
 }
+
+func (s *Server) servers() []*http.Server {
+	servers := []*http.Server{s.server}
+	for _, server := range []*http.Server{s.adminServer, s.debugServer} {
+		if server != nil {
+			servers = append(servers, server)
+		}
+	}
+
+	return servers
+}
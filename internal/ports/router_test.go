@@ -0,0 +1,43 @@
+package ports
+
+import (
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"url-shortner/internal/config"
+	"url-shortner/internal/ports/rest"
+	"url-shortner/pkg/logger/slogdiscard"
+)
+
+func TestRouters_AdminRoutesArePrivate(t *testing.T) {
+	logger := slogdiscard.NewDiscardLogger()
+	handler := rest.NewHandler(logger, nil, nil, nil, nil, nil, http.StatusFound, 0, 1)
+
+	public := InitRouter(handler, logger, &config.Limiter{RPS: 1, Burst: 1})
+	admin := InitAdminRouter(handler, logger)
+
+	// the public router still matches /api/urls/{code}, but never with the admin handlers
+	testCases := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/api/urls"},
+		{http.MethodPost, "/api/urls/import"},
+		{http.MethodPatch, "/api/urls/abc"},
+		{http.MethodDelete, "/api/urls/abc"},
+	}
+
+	for _, tc := range testCases {
+		assert.False(t, public.Match(chi.NewRouteContext(), tc.method, tc.path), tc.path)
+		assert.True(t, admin.Match(chi.NewRouteContext(), tc.method, tc.path), tc.path)
+	}
+
+	ctx := chi.NewRouteContext()
+	assert.True(t, admin.Match(ctx, http.MethodGet, "/api/urls/export"))
+	assert.Equal(t, "/api/urls/export", ctx.RoutePattern())
+
+	ctx = chi.NewRouteContext()
+	assert.True(t, public.Match(ctx, http.MethodGet, "/api/urls/export"))
+	assert.Equal(t, "/api/urls/{code}", ctx.RoutePattern())
+}
@@ -0,0 +1,170 @@
+package analytics
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+	"url-shortner/internal/domain"
+)
+
+const (
+	// flushTimeout limits the final flush on shutdown
+	flushTimeout = 5 * time.Second
+	// partitionsInterval is how often the click partitions are checked
+	partitionsInterval = 24 * time.Hour
+)
+
+type Store interface {
+	InsertClicks(ctx context.Context, clicks []*domain.Click) error
+	EnsureClickPartitions(ctx context.Context, now time.Time) error
+	ClickReport(ctx context.Context, filter *domain.ClickFilter) (*domain.ClickReport, error)
+}
+
+// event is a raw click waiting in the queue, it is parsed off the redirect path
+type event struct {
+	linkID    int
+	clickedAt time.Time
+	referrer  string
+	userAgent string
+}
+
+// Analytics collects clicks through a bounded queue and writes them to the store in batches.
+// Clicks are dropped when the queue is full, so that redirects never block on analytics.
+type Analytics struct {
+	queue         chan event
+	store         Store
+	batchSize     int
+	flushInterval time.Duration
+	dropped       atomic.Int64
+	logger        *slog.Logger
+}
+
+func New(logger *slog.Logger, store Store, queueSize, batchSize int, flushInterval time.Duration) *Analytics {
+	return &Analytics{
+		queue:         make(chan event, queueSize),
+		store:         store,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		logger:        logger,
+	}
+}
+
+// Track enqueues a click on the link without blocking.
+func (a *Analytics) Track(linkID int, referrer, userAgent string) {
+	select {
+	case a.queue <- event{linkID: linkID, clickedAt: time.Now(), referrer: referrer, userAgent: userAgent}:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of clicks lost because the queue was full.
+func (a *Analytics) Dropped() int64 {
+	return a.dropped.Load()
+}
+
+// Report returns aggregated clicks of the link.
+func (a *Analytics) Report(ctx context.Context, filter *domain.ClickFilter) (*domain.ClickReport, error) {
+	return a.store.ClickReport(ctx, filter)
+}
+
+// Run consumes the queue until the context is done.
+// A batch is written when it is full or every flush interval.
+// The queued clicks are written before return.
+func (a *Analytics) Run(ctx context.Context) error {
+	a.ensurePartitions(ctx)
+
+	flushTicker := time.NewTicker(a.flushInterval)
+	defer flushTicker.Stop()
+
+	partitionsTicker := time.NewTicker(partitionsInterval)
+	defer partitionsTicker.Stop()
+
+	batch := make([]*domain.Click, 0, a.batchSize)
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+			defer cancel()
+
+			for {
+				select {
+				case e := <-a.queue:
+					batch = append(batch, newClick(e))
+					if len(batch) == a.batchSize {
+						batch = a.flush(flushCtx, batch)
+					}
+				default:
+					a.flush(flushCtx, batch)
+					return ctx.Err()
+				}
+			}
+
+		case e := <-a.queue:
+			batch = append(batch, newClick(e))
+			if len(batch) == a.batchSize {
+				batch = a.flush(ctx, batch)
+			}
+
+		case <-flushTicker.C:
+			batch = a.flush(ctx, batch)
+
+		case <-partitionsTicker.C:
+			a.ensurePartitions(ctx)
+		}
+	}
+}
+
+// flush writes the batch and returns an empty one to fill.
+// A failed batch is dropped, since retrying would make the queue overflow anyway.
+func (a *Analytics) flush(ctx context.Context, batch []*domain.Click) []*domain.Click {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	err := a.store.InsertClicks(ctx, batch)
+	if err != nil {
+		a.logger.Error("failed to write clicks", slog.Int("count", len(batch)), slog.String("error", err.Error()))
+	}
+
+	return make([]*domain.Click, 0, a.batchSize)
+}
+
+func (a *Analytics) ensurePartitions(ctx context.Context) {
+	err := a.store.EnsureClickPartitions(ctx, time.Now().UTC())
+	if err != nil {
+		a.logger.Error("failed to create click partitions", slog.String("error", err.Error()))
+	}
+}
+
+func newClick(e event) *domain.Click {
+	ua := ParseUserAgent(e.userAgent)
+
+	return &domain.Click{
+		LinkID:    e.linkID,
+		ClickedAt: e.clickedAt,
+		Referrer:  referrerHost(e.referrer),
+		Browser:   ua.Browser,
+		OS:        ua.OS,
+		Device:    ua.Device,
+		Bot:       ua.Bot,
+	}
+}
+
+// referrerHost keeps only the host of the referrer, since full urls may contain personal data
+func referrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+
+	uri, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(uri.Hostname())
+}
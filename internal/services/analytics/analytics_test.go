@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+	"url-shortner/internal/domain"
+	"url-shortner/pkg/logger/slogdiscard"
+)
+
+type fakeStore struct {
+	mu      sync.Mutex
+	batches [][]*domain.Click
+}
+
+func (s *fakeStore) InsertClicks(_ context.Context, clicks []*domain.Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = append(s.batches, clicks)
+	return nil
+}
+
+func (s *fakeStore) EnsureClickPartitions(context.Context, time.Time) error {
+	return nil
+}
+
+func (s *fakeStore) ClickReport(context.Context, *domain.ClickFilter) (*domain.ClickReport, error) {
+	return &domain.ClickReport{}, nil
+}
+
+func TestAnalytics_TrackDropsWhenQueueIsFull(t *testing.T) {
+	analytics := New(slogdiscard.NewDiscardLogger(), &fakeStore{}, 1, 10, time.Hour)
+
+	analytics.Track(1, "", "")
+	analytics.Track(1, "", "")
+
+	assert.Equal(t, int64(1), analytics.Dropped())
+}
+
+func TestAnalytics_Run(t *testing.T) {
+	store := &fakeStore{}
+	analytics := New(slogdiscard.NewDiscardLogger(), store, 10, 2, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		analytics.Track(1, "https://News.example.com/item?id=1", "curl/8.5.0")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- analytics.Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.batches) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// the rest of the queue is written on shutdown
+	cancel()
+	<-done
+
+	assert.Len(t, store.batches, 2)
+	assert.Len(t, store.batches[0], 2)
+	assert.Len(t, store.batches[1], 1)
+	assert.Equal(t, "news.example.com", store.batches[0][0].Referrer)
+	assert.True(t, store.batches[0][0].Bot)
+}
@@ -0,0 +1,118 @@
+package analytics
+
+import "strings"
+
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+
+	unknown = "other"
+)
+
+// UserAgent is a coarse description of the client
+type UserAgent struct {
+	Browser string
+	OS      string
+	Device  string
+	Bot     bool
+}
+
+// token maps a lowercase user agent substring to a name
+type token struct {
+	substr string
+	name   string
+}
+
+// order matters: e.g. Edge and Opera user agents also mention Chrome and Safari
+var (
+	botTokens = []string{
+		"bot", "crawl", "spider", "slurp", "facebookexternalhit", "preview", "headless",
+		"curl/", "wget/", "python-requests", "go-http-client", "okhttp", "java/",
+	}
+
+	browserTokens = []token{
+		{"edg/", "Edge"},
+		{"edga/", "Edge"},
+		{"edgios/", "Edge"},
+		{"opr/", "Opera"},
+		{"opera", "Opera"},
+		{"samsungbrowser/", "Samsung Internet"},
+		{"yabrowser/", "Yandex"},
+		{"firefox/", "Firefox"},
+		{"fxios/", "Firefox"},
+		{"crios/", "Chrome"},
+		{"chrome/", "Chrome"},
+		{"chromium/", "Chrome"},
+		{"safari/", "Safari"},
+		{"msie ", "Internet Explorer"},
+		{"trident/", "Internet Explorer"},
+	}
+
+	osTokens = []token{
+		{"windows", "Windows"},
+		{"iphone", "iOS"},
+		{"ipad", "iOS"},
+		{"ipod", "iOS"},
+		{"android", "Android"},
+		{"cros", "ChromeOS"},
+		{"mac os x", "macOS"},
+		{"macintosh", "macOS"},
+		{"linux", "Linux"},
+	}
+)
+
+// ParseUserAgent detects browser, OS and device class from User-Agent header.
+// Empty user agent is considered to be a bot, since browsers always send one.
+func ParseUserAgent(header string) UserAgent {
+	ua := strings.ToLower(header)
+
+	if ua == "" || containsAny(ua, botTokens) {
+		return UserAgent{
+			Browser: unknown,
+			OS:      unknown,
+			Device:  DeviceBot,
+			Bot:     true,
+		}
+	}
+
+	return UserAgent{
+		Browser: match(ua, browserTokens),
+		OS:      match(ua, osTokens),
+		Device:  device(ua),
+	}
+}
+
+func device(ua string) string {
+	switch {
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet"):
+		return DeviceTablet
+	case strings.Contains(ua, "android") && !strings.Contains(ua, "mobile"):
+		return DeviceTablet
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "ipod"):
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
+
+func match(ua string, tokens []token) string {
+	for _, t := range tokens {
+		if strings.Contains(ua, t.substr) {
+			return t.name
+		}
+	}
+
+	return unknown
+}
+
+func containsAny(ua string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(ua, substr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,42 @@
+package analytics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	testCases := map[string]UserAgent{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36": {
+			Browser: "Chrome", OS: "Windows", Device: DeviceDesktop,
+		},
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0": {
+			Browser: "Edge", OS: "Windows", Device: DeviceDesktop,
+		},
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1": {
+			Browser: "Safari", OS: "iOS", Device: DeviceMobile,
+		},
+		"Mozilla/5.0 (iPad; CPU OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1": {
+			Browser: "Safari", OS: "iOS", Device: DeviceTablet,
+		},
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36": {
+			Browser: "Chrome", OS: "Android", Device: DeviceMobile,
+		},
+		"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0": {
+			Browser: "Firefox", OS: "Linux", Device: DeviceDesktop,
+		},
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)": {
+			Browser: unknown, OS: unknown, Device: DeviceBot, Bot: true,
+		},
+		"curl/8.5.0": {
+			Browser: unknown, OS: unknown, Device: DeviceBot, Bot: true,
+		},
+		"": {
+			Browser: unknown, OS: unknown, Device: DeviceBot, Bot: true,
+		},
+	}
+
+	for header, expected := range testCases {
+		assert.Equal(t, expected, ParseUserAgent(header), header)
+	}
+}
@@ -0,0 +1,95 @@
+package canonical
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// defaultPorts are dropped from hosts of urls with the matching scheme
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// trackingParams are query params which don't change the page, params with trackingPrefixes are tracking too
+var (
+	trackingParams   = map[string]struct{}{"fbclid": {}, "gclid": {}, "dclid": {}, "msclkid": {}, "yclid": {}, "mc_cid": {}, "mc_eid": {}, "_ga": {}}
+	trackingPrefixes = []string{"utm_"}
+)
+
+// Canonicalizer turns urls pointing to the same page into the same string, so that they are deduplicated.
+type Canonicalizer struct {
+	stripTracking bool
+}
+
+// New returns the canonicalizer, which also removes tracking params, if stripTracking is set.
+func New(stripTracking bool) *Canonicalizer {
+	return &Canonicalizer{stripTracking: stripTracking}
+}
+
+// Canonical lowercases the scheme and host, drops the default port and the fragment,
+// and sorts query params. Urls which can't be parsed are returned as is, queries which can't be parsed are kept.
+func (c *Canonicalizer) Canonical(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+
+	if host, port, err := net.SplitHostPort(u.Host); err == nil && defaultPorts[u.Scheme] == port {
+		u.Host = host
+		// brackets of ipv6 hosts are dropped by SplitHostPort
+		if strings.Contains(host, ":") {
+			u.Host = "[" + host + "]"
+		}
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	u.ForceQuery = false
+
+	// queries which can't be parsed, for example with semicolons, are kept as is,
+	// since dropping the unparsed params would deduplicate different pages
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return u.String()
+	}
+
+	if c.stripTracking {
+		for param := range query {
+			if isTracking(param) {
+				query.Del(param)
+			}
+		}
+	}
+
+	// Encode sorts params by key
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func isTracking(param string) bool {
+	param = strings.ToLower(param)
+
+	if _, ok := trackingParams[param]; ok {
+		return true
+	}
+
+	for _, prefix := range trackingPrefixes {
+		if strings.HasPrefix(param, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,123 @@
+package encoder
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"url-shortner/internal/domain"
+)
+
+const (
+	MinCodeLength = 2
+	MaxCodeLength = 10
+)
+
+// Generator produces short codes for new links.
+// attempt is incremented after every collision, so that another code can be produced.
+type Generator interface {
+	Generate(link *domain.Link, attempt int) (string, error)
+}
+
+// Codec turns link ids into short codes and back
+type Codec interface {
+	Encode(int) string
+	Decode(string) (int, error)
+	Normalize(string) string
+}
+
+// Sequential derives the code from the link id.
+// The id is new on every attempt, so attempt itself is not used.
+type Sequential struct {
+	codec Codec
+}
+
+func NewSequential(codec Codec) *Sequential {
+	return &Sequential{codec: codec}
+}
+
+func (s *Sequential) Generate(link *domain.Link, _ int) (string, error) {
+	return s.codec.Encode(link.ID), nil
+}
+
+// Random produces codes of fixed length which do not depend on the link id.
+type Random struct {
+	space *codeSpace
+}
+
+func NewRandom(encoder *Encoder, length int) (*Random, error) {
+	space, err := newCodeSpace(encoder, length)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Random{space: space}, nil
+}
+
+func (r *Random) Generate(_ *domain.Link, _ int) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(r.space.size)))
+	if err != nil {
+		return "", fmt.Errorf("encoder.Random.Generate: %w", err)
+	}
+
+	return r.space.code(int(n.Int64())), nil
+}
+
+// Hash produces codes of fixed length derived from the destination url,
+// so that the same url gets the same code unless it collides.
+// Retries also hash the link id, since links for the same url which are not deduplicated
+// would collide on every attempt otherwise.
+type Hash struct {
+	space *codeSpace
+}
+
+func NewHash(encoder *Encoder, length int) (*Hash, error) {
+	space, err := newCodeSpace(encoder, length)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Hash{space: space}, nil
+}
+
+func (h *Hash) Generate(link *domain.Link, attempt int) (string, error) {
+	input := fmt.Sprintf("%d:%s", attempt, link.URL)
+	if attempt > 0 {
+		input = fmt.Sprintf("%d:%d:%s", attempt, link.ID, link.URL)
+	}
+
+	sum := sha256.Sum256([]byte(input))
+	n := binary.BigEndian.Uint64(sum[:8]) % uint64(h.space.size)
+
+	return h.space.code(int(n)), nil
+}
+
+// codeSpace is the set of codes of fixed length.
+// Numbers in [min, min+size) are encoded with exactly length chars.
+type codeSpace struct {
+	encoder *Encoder
+	min     int
+	size    int
+}
+
+func newCodeSpace(encoder *Encoder, length int) (*codeSpace, error) {
+	if length < MinCodeLength || length > MaxCodeLength {
+		return nil, fmt.Errorf("code length should be in %d-%d range, got %d", MinCodeLength, MaxCodeLength, length)
+	}
+
+	minimum := 1
+	for i := 1; i < length; i++ {
+		minimum *= encoder.Base
+	}
+
+	return &codeSpace{
+		encoder: encoder,
+		min:     minimum,
+		size:    minimum * (encoder.Base - 1),
+	}, nil
+}
+
+func (s *codeSpace) code(n int) string {
+	return s.encoder.Encode(s.min + n)
+}
@@ -0,0 +1,60 @@
+package encoder
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"url-shortner/internal/domain"
+)
+
+func TestSequential_Generate(t *testing.T) {
+	generator := NewSequential(New())
+
+	code, err := generator.Generate(&domain.Link{ID: 62}, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "ba", code)
+}
+
+func TestRandom_Generate(t *testing.T) {
+	generator, err := NewRandom(New(), 6)
+	assert.NoError(t, err)
+
+	codes := make(map[string]struct{})
+	for i := 0; i < 100; i++ {
+		code, err := generator.Generate(&domain.Link{ID: 1}, 0)
+		assert.NoError(t, err)
+		assert.Len(t, code, 6)
+
+		for _, c := range code {
+			assert.True(t, strings.ContainsRune(Alphabet, c))
+		}
+
+		codes[code] = struct{}{}
+	}
+
+	assert.Greater(t, len(codes), 90)
+}
+
+func TestHash_Generate(t *testing.T) {
+	generator, err := NewHash(New(), MaxCodeLength)
+	assert.NoError(t, err)
+
+	link := &domain.Link{URL: "https://example.com/page"}
+
+	first, _ := generator.Generate(link, 0)
+	again, _ := generator.Generate(link, 0)
+	retry, _ := generator.Generate(link, 1)
+
+	assert.Len(t, first, MaxCodeLength)
+	assert.Equal(t, first, again)
+	assert.NotEqual(t, first, retry)
+
+	// retries of another link for the same url produce other codes
+	other, _ := generator.Generate(&domain.Link{ID: 2, URL: link.URL}, 1)
+	assert.NotEqual(t, retry, other)
+}
+
+func TestNewRandom_InvalidLength(t *testing.T) {
+	_, err := NewRandom(New(), MaxCodeLength+1)
+	assert.Error(t, err)
+}
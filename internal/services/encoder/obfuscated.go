@@ -0,0 +1,77 @@
+package encoder
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+const (
+	// ids are permuted within 40 bits, so that codes stay up to 7 chars long
+	halfBits   = 20
+	halfMask   = 1<<halfBits - 1
+	domainMask = 1<<(2*halfBits) - 1
+	rounds     = 4
+)
+
+// Obfuscated encodes ids permuted by a keyed Feistel network,
+// so that consecutive ids get unrelated codes and links can not be enumerated.
+// The permutation is a bijection, so codes stay reversible and collision-free.
+type Obfuscated struct {
+	*Encoder
+	secret []byte
+}
+
+func NewObfuscated(encoder *Encoder, secret string) *Obfuscated {
+	return &Obfuscated{
+		Encoder: encoder,
+		secret:  []byte(secret),
+	}
+}
+
+func (o *Obfuscated) Encode(id int) string {
+	return o.Encoder.Encode(int(o.permute(uint64(id))))
+}
+
+func (o *Obfuscated) Decode(code string) (int, error) {
+	id, err := o.Encoder.Decode(code)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(o.unpermute(uint64(id))), nil
+}
+
+// permute shuffles the lower 40 bits of x, the higher bits are kept as is.
+func (o *Obfuscated) permute(x uint64) uint64 {
+	l, r := (x>>halfBits)&halfMask, x&halfMask
+
+	for i := 0; i < rounds; i++ {
+		l, r = r, l^o.round(i, r)
+	}
+
+	return x&^domainMask | l<<halfBits | r
+}
+
+// unpermute is the inverse of permute.
+func (o *Obfuscated) unpermute(x uint64) uint64 {
+	l, r := (x>>halfBits)&halfMask, x&halfMask
+
+	for i := rounds - 1; i >= 0; i-- {
+		l, r = r^o.round(i, l), l
+	}
+
+	return x&^domainMask | l<<halfBits | r
+}
+
+// round is the keyed round function of the Feistel network.
+func (o *Obfuscated) round(i int, half uint64) uint64 {
+	var buf [5]byte
+	buf[0] = byte(i)
+	binary.BigEndian.PutUint32(buf[1:], uint32(half))
+
+	mac := hmac.New(sha256.New, o.secret)
+	mac.Write(buf[:])
+
+	return uint64(binary.BigEndian.Uint32(mac.Sum(nil))) & halfMask
+}
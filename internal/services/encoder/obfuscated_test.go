@@ -0,0 +1,40 @@
+package encoder
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestObfuscated_RoundTrip(t *testing.T) {
+	encoder := NewObfuscated(New(), "secret")
+
+	for _, id := range []int{0, 1, 2, 61, 62, 1 << 20, 1<<40 - 1, 1 << 40, 1<<40 + 12345, 1 << 50} {
+		decoded, err := encoder.Decode(encoder.Encode(id))
+		assert.NoError(t, err)
+		assert.Equal(t, id, decoded, id)
+	}
+}
+
+func TestObfuscated_NoCollisions(t *testing.T) {
+	encoder := NewObfuscated(New(), "secret")
+	codes := make(map[string]int)
+
+	for id := 0; id < 100000; id++ {
+		code := encoder.Encode(id)
+		if other, ok := codes[code]; ok {
+			t.Fatalf("ids %d and %d have the same code %s", other, id, code)
+		}
+
+		codes[code] = id
+		assert.LessOrEqual(t, len(code), 7)
+	}
+}
+
+func TestObfuscated_Keyed(t *testing.T) {
+	encoder := NewObfuscated(New(), "secret")
+	other := NewObfuscated(New(), "another secret")
+
+	assert.NotEqual(t, encoder.Encode(1), encoder.Encode(2))
+	assert.NotEqual(t, encoder.Encode(1), other.Encode(1))
+	assert.NotEqual(t, New().Encode(1), encoder.Encode(1))
+}
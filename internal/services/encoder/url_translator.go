@@ -1,47 +1,211 @@
 package encoder
 
-import "strings"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"url-shortner/internal/domain"
+)
 
 const (
 	Alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	Base     = len(Alphabet)
+
+	MinAlphabetLength = 10
+	MaxAlphabetLength = 64
+)
+
+var (
+	ErrEmptyCode    = errors.New("code is empty")
+	ErrInvalidChar  = errors.New("code contains invalid character")
+	ErrCodeTooLong  = errors.New("code is too long")
+	ErrCodeOverflow = domain.ErrCodeOverflow
+	ErrCheckDigit   = domain.ErrCodeMistyped
 )
 
 type Encoder struct {
 	Alphabet string
 	Base     int
+	// MinLength is the length codes are padded to with the first char of the alphabet
+	MinLength int
+	// MaxLength is the length of the code of the biggest id
+	MaxLength int
+	// CaseInsensitive encoders emit lowercase codes and accept codes in any case
+	CaseInsensitive bool
+	// CheckDigit adds the Luhn mod N check char to the end of codes, which catches
+	// any single mistyped char and most swaps of adjacent chars. It requires an alphabet of even length.
+	CheckDigit bool
+
+	// digits maps chars of the alphabet to their values, other chars are mapped to -1
+	digits [256]int
 }
 
+// New returns the encoder with the default alphabet
 func New() *Encoder {
-	return &Encoder{
-		Alphabet: Alphabet,
-		Base:     Base,
+	encoder, _ := NewCustom(Alphabet, 0, false)
+	return encoder
+}
+
+// NewCustom returns the encoder with the given alphabet, which should consist of
+// unique url-safe chars. Letters are lowercased in the case-insensitive mode.
+func NewCustom(alphabet string, minLength int, caseInsensitive bool) (*Encoder, error) {
+	if caseInsensitive {
+		alphabet = strings.ToLower(alphabet)
+	}
+
+	if len(alphabet) < MinAlphabetLength || len(alphabet) > MaxAlphabetLength {
+		return nil, fmt.Errorf("alphabet length should be in %d-%d range, got %d", MinAlphabetLength, MaxAlphabetLength, len(alphabet))
+	}
+
+	if minLength < 0 || minLength > MaxCodeLength {
+		return nil, fmt.Errorf("min code length should be in 0-%d range, got %d", MaxCodeLength, minLength)
+	}
+
+	e := &Encoder{
+		Alphabet:        alphabet,
+		Base:            len(alphabet),
+		MinLength:       minLength,
+		CaseInsensitive: caseInsensitive,
+	}
+
+	for i := range e.digits {
+		e.digits[i] = -1
+	}
+
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		if !isCodeChar(c) {
+			return nil, fmt.Errorf("alphabet contains invalid char %q", c)
+		}
+
+		if e.digits[c] >= 0 {
+			return nil, fmt.Errorf("alphabet contains duplicate char %q", c)
+		}
+
+		e.digits[c] = i
+		if caseInsensitive && c >= 'a' && c <= 'z' {
+			e.digits[c-'a'+'A'] = i
+		}
+	}
+
+	e.MaxLength = max(len(e.encode(math.MaxInt)), minLength)
+
+	return e, nil
+}
+
+// WithCheckDigit returns the copy of the encoder, which emits and verifies check digits.
+// Luhn mod N only catches every single mistyped char when N is even, since doubling is not
+// a permutation of digits otherwise, so alphabets of odd length are rejected.
+func (e *Encoder) WithCheckDigit() (*Encoder, error) {
+	if e.Base%2 != 0 {
+		return nil, fmt.Errorf("alphabet length should be even for check digits, got %d", e.Base)
 	}
+
+	withCheck := *e
+	withCheck.CheckDigit = true
+	withCheck.MaxLength++
+
+	return &withCheck, nil
 }
 
 func (e *Encoder) Encode(id int) string {
+	code := e.encode(id)
+	if len(code) < e.MinLength {
+		code = strings.Repeat(e.Alphabet[:1], e.MinLength-len(code)) + code
+	}
+
+	if e.CheckDigit {
+		code += string(e.Alphabet[e.checkDigit(code)])
+	}
+
+	return code
+}
+
+// Decode returns the id encoded in the code.
+// It returns error if the code has chars out of the alphabet, a wrong check digit or does not fit into int.
+func (e *Encoder) Decode(code string) (int, error) {
+	if code == "" {
+		return 0, ErrEmptyCode
+	}
+
+	if len(code) > e.MaxLength {
+		return 0, ErrCodeTooLong
+	}
+
+	for i := 0; i < len(code); i++ {
+		if e.digits[code[i]] < 0 {
+			return 0, ErrInvalidChar
+		}
+	}
+
+	if e.CheckDigit {
+		last := len(code) - 1
+		if last == 0 || e.checkDigit(code[:last]) != e.digits[code[last]] {
+			return 0, ErrCheckDigit
+		}
+
+		code = code[:last]
+	}
+
+	id := 0
+
+	for i := 0; i < len(code); i++ {
+		digit := e.digits[code[i]]
+
+		if id > (math.MaxInt-digit)/e.Base {
+			return 0, ErrCodeOverflow
+		}
+
+		id = id*e.Base + digit
+	}
+
+	return id, nil
+}
+
+// Normalize returns the code in the form emitted by Encode,
+// it only differs from the code in the case-insensitive mode.
+func (e *Encoder) Normalize(code string) string {
+	if e.CaseInsensitive {
+		return strings.ToLower(code)
+	}
+
+	return code
+}
+
+// checkDigit returns the value of the Luhn mod N check char of the code,
+// which should only consist of chars of the alphabet.
+func (e *Encoder) checkDigit(code string) int {
+	factor, sum := 2, 0
+
+	for i := len(code) - 1; i >= 0; i-- {
+		addend := factor * e.digits[code[i]]
+		sum += addend/e.Base + addend%e.Base
+
+		factor = 3 - factor
+	}
+
+	return (e.Base - sum%e.Base) % e.Base
+}
+
+func (e *Encoder) encode(id int) string {
 	if id == 0 {
-		return string(Alphabet[0])
+		return e.Alphabet[:1]
 	}
 
 	buf := strings.Builder{}
 
 	for id > 0 {
-		buf.WriteByte(Alphabet[id%Base])
-		id /= Base
+		buf.WriteByte(e.Alphabet[id%e.Base])
+		id /= e.Base
 	}
 
 	return Reverse(buf.String())
 }
 
-func (e *Encoder) Decode(code string) int {
-	id := 0
-
-	for _, c := range code {
-		id = id*Base + strings.Index(Alphabet, string(c))
-	}
-
-	return id
+// isCodeChar reports whether c may be used in a code without escaping it in url path
+func isCodeChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
 }
 
 func Reverse(s string) string {
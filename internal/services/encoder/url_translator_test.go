@@ -2,6 +2,9 @@ package encoder
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"strings"
 	"testing"
 )
 
@@ -31,6 +34,186 @@ func TestDecode(t *testing.T) {
 	encoder := New()
 
 	for code, expectedID := range testCases {
-		assert.Equal(t, expectedID, encoder.Decode(code))
+		id, err := encoder.Decode(code)
+		assert.NoError(t, err)
+		assert.Equal(t, expectedID, id)
 	}
 }
+
+func TestDecode_Invalid(t *testing.T) {
+	testCases := map[string]error{
+		"":             ErrEmptyCode,
+		"abc-!":        ErrInvalidChar,
+		"ab c":         ErrInvalidChar,
+		"ключ":         ErrInvalidChar,
+		"aaaaaaaaaaab": ErrCodeTooLong,
+		"99999999999":  ErrCodeOverflow,
+	}
+
+	encoder := New()
+
+	for code, expectedErr := range testCases {
+		_, err := encoder.Decode(code)
+		assert.ErrorIs(t, err, expectedErr, code)
+	}
+}
+
+func TestDecode_MaxInt(t *testing.T) {
+	encoder := New()
+
+	id, err := encoder.Decode(encoder.Encode(math.MaxInt))
+	assert.NoError(t, err)
+	assert.Equal(t, math.MaxInt, id)
+}
+
+func TestNewCustom(t *testing.T) {
+	encoder, err := NewCustom("abcdefghijkmnpqrstuvwxyz23456789", 5, false)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 32, encoder.Base)
+	assert.Equal(t, "aaaab", encoder.Encode(1))
+	assert.Equal(t, "aaaba", encoder.Encode(32))
+
+	id, err := encoder.Decode("aaaba")
+	assert.NoError(t, err)
+	assert.Equal(t, 32, id)
+
+	// look-alike chars are out of the alphabet
+	_, err = encoder.Decode("aaa0l")
+	assert.ErrorIs(t, err, ErrInvalidChar)
+}
+
+func TestNewCustom_CaseInsensitive(t *testing.T) {
+	encoder, err := NewCustom("ABCDEFGHJKMNPQRSTUVWXYZ23456789", 0, true)
+	assert.NoError(t, err)
+
+	code := encoder.Encode(1000)
+	assert.Equal(t, strings.ToLower(code), code)
+
+	id, err := encoder.Decode(strings.ToUpper(code))
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, id)
+
+	assert.Equal(t, code, encoder.Normalize(strings.ToUpper(code)))
+	assert.Equal(t, "AbC", New().Normalize("AbC"))
+}
+
+func TestNewCustom_Invalid(t *testing.T) {
+	testCases := map[string]struct {
+		alphabet        string
+		minLength       int
+		caseInsensitive bool
+	}{
+		"short alphabet":          {alphabet: "abc"},
+		"duplicate chars":         {alphabet: "abcdefghijka"},
+		"unsafe chars":            {alphabet: "abcdefghij/?"},
+		"duplicate ignoring case": {alphabet: Alphabet, caseInsensitive: true},
+		"long min length":         {alphabet: Alphabet, minLength: MaxCodeLength + 1},
+	}
+
+	for name, tc := range testCases {
+		_, err := NewCustom(tc.alphabet, tc.minLength, tc.caseInsensitive)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestCheckDigit(t *testing.T) {
+	for _, alphabet := range []string{Alphabet, "abcdefghijkmnpqrstuvwxyz23456789", "0123456789", "0123456789ab"} {
+		custom, err := NewCustom(alphabet, 0, false)
+		require.NoError(t, err)
+
+		encoder, err := custom.WithCheckDigit()
+		require.NoError(t, err)
+
+		for _, id := range []int{0, 7, 123456, 1 << 40} {
+			code := encoder.Encode(id)
+			assert.Len(t, code, len(custom.Encode(id))+1)
+
+			decoded, err := encoder.Decode(code)
+			assert.NoError(t, err)
+			assert.Equal(t, id, decoded)
+
+			// every single mistyped char is caught
+			for i := 0; i < len(code); i++ {
+				for j := 0; j < len(alphabet); j++ {
+					if alphabet[j] == code[i] {
+						continue
+					}
+
+					mistyped := code[:i] + string(alphabet[j]) + code[i+1:]
+					_, err = encoder.Decode(mistyped)
+					assert.ErrorIs(t, err, ErrCheckDigit, mistyped)
+				}
+			}
+		}
+	}
+
+	encoder, err := New().WithCheckDigit()
+	require.NoError(t, err)
+
+	_, err = encoder.Decode("a")
+	assert.ErrorIs(t, err, ErrCheckDigit)
+
+	_, err = encoder.Decode("ab-")
+	assert.ErrorIs(t, err, ErrInvalidChar)
+}
+
+func TestCheckDigit_OddAlphabet(t *testing.T) {
+	custom, err := NewCustom("ABCDEFGHJKMNPQRSTUVWXYZ23456789", 0, true)
+	require.NoError(t, err)
+
+	_, err = custom.WithCheckDigit()
+	assert.Error(t, err)
+}
+
+func FuzzEncodeDecode(f *testing.F) {
+	for _, seed := range []int{0, 1, 61, 62, 3843, 1 << 40, math.MaxInt} {
+		f.Add(seed)
+	}
+
+	encoder := New()
+	obfuscated := NewObfuscated(New(), "secret")
+	custom, _ := NewCustom("abcdefghijkmnpqrstuvwxyz23456789", 6, true)
+	withCheck, _ := custom.WithCheckDigit()
+
+	f.Fuzz(func(t *testing.T, id int) {
+		if id < 0 {
+			t.Skip()
+		}
+
+		for _, codec := range []Codec{encoder, obfuscated, custom, withCheck} {
+			decoded, err := codec.Decode(codec.Encode(id))
+			if err != nil {
+				t.Fatalf("failed to decode code of %d: %v", id, err)
+			}
+
+			if decoded != id {
+				t.Fatalf("round trip of %d returned %d", id, decoded)
+			}
+		}
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, seed := range []string{"a", "ba", "abc-!", "99999999999", "aaaaaaaaaaab"} {
+		f.Add(seed)
+	}
+
+	encoder := New()
+
+	f.Fuzz(func(t *testing.T, code string) {
+		id, err := encoder.Decode(code)
+		if err != nil {
+			return
+		}
+
+		if id < 0 {
+			t.Fatalf("code %q decoded to negative id %d", code, id)
+		}
+
+		again, err := encoder.Decode(encoder.Encode(id))
+		if err != nil || again != id {
+			t.Fatalf("code %q decoded to %d, which does not round trip", code, id)
+		}
+	})
+}
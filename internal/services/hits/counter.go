@@ -0,0 +1,93 @@
+package hits
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// flushTimeout limits the final flush on shutdown
+const flushTimeout = 5 * time.Second
+
+type Store interface {
+	IncrementClicks(ctx context.Context, clicks map[int]int64) error
+}
+
+// Counter buffers link clicks in memory and periodically flushes them to the store,
+// so that redirects never wait for a database write.
+type Counter struct {
+	mu       sync.Mutex
+	pending  map[int]int64
+	store    Store
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+func New(logger *slog.Logger, store Store, interval time.Duration) *Counter {
+	return &Counter{
+		pending:  make(map[int]int64),
+		store:    store,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Hit registers a click on the link.
+func (c *Counter) Hit(id int) {
+	c.mu.Lock()
+	c.pending[id]++
+	c.mu.Unlock()
+}
+
+// Pending returns the number of clicks on the link which are not flushed yet.
+func (c *Counter) Pending(id int) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.pending[id]
+}
+
+// Run flushes clicks every interval until the context is done.
+// The remaining clicks are flushed before return.
+func (c *Counter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+			c.flush(flushCtx)
+			cancel()
+
+			return ctx.Err()
+
+		case <-ticker.C:
+			c.flush(ctx)
+		}
+	}
+}
+
+func (c *Counter) flush(ctx context.Context) {
+	c.mu.Lock()
+	clicks := c.pending
+	c.pending = make(map[int]int64)
+	c.mu.Unlock()
+
+	if len(clicks) == 0 {
+		return
+	}
+
+	err := c.store.IncrementClicks(ctx, clicks)
+	if err != nil {
+		c.logger.Error("failed to flush clicks", slog.String("error", err.Error()))
+
+		// put the clicks back, so that they are flushed next time
+		c.mu.Lock()
+		for id, n := range clicks {
+			c.pending[id] += n
+		}
+		c.mu.Unlock()
+	}
+}
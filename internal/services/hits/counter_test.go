@@ -0,0 +1,57 @@
+package hits
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"url-shortner/pkg/logger/slogdiscard"
+)
+
+type fakeStore struct {
+	clicks map[int]int64
+	err    error
+}
+
+func (s *fakeStore) IncrementClicks(_ context.Context, clicks map[int]int64) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	for id, n := range clicks {
+		s.clicks[id] += n
+	}
+
+	return nil
+}
+
+func TestCounter_Flush(t *testing.T) {
+	store := &fakeStore{clicks: make(map[int]int64)}
+	counter := New(slogdiscard.NewDiscardLogger(), store, 0)
+
+	counter.Hit(1)
+	counter.Hit(1)
+	counter.Hit(2)
+	assert.Equal(t, int64(2), counter.Pending(1))
+
+	counter.flush(context.Background())
+
+	assert.Equal(t, map[int]int64{1: 2, 2: 1}, store.clicks)
+	assert.Equal(t, int64(0), counter.Pending(1))
+}
+
+func TestCounter_FlushFailure(t *testing.T) {
+	store := &fakeStore{clicks: make(map[int]int64), err: errors.New("db is down")}
+	counter := New(slogdiscard.NewDiscardLogger(), store, 0)
+
+	counter.Hit(1)
+	counter.flush(context.Background())
+	counter.Hit(1)
+
+	assert.Equal(t, int64(2), counter.Pending(1))
+
+	store.err = nil
+	counter.flush(context.Background())
+
+	assert.Equal(t, map[int]int64{1: 2}, store.clicks)
+}
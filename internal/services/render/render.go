@@ -8,16 +8,18 @@ import (
 )
 
 type Render struct {
-	homeTemplate *template.Template
-	iconPath     string
-	logger       *slog.Logger
+	homeTemplate     *template.Template
+	mistypedTemplate *template.Template
+	iconPath         string
+	logger           *slog.Logger
 }
 
 func New(templatePath string, logger *slog.Logger) *Render {
 	return &Render{
-		homeTemplate: template.Must(template.ParseFiles(fmt.Sprintf("%s/%s", templatePath, "home.html"))),
-		iconPath:     fmt.Sprintf("%s/%s", templatePath, "u.png"),
-		logger:       logger,
+		homeTemplate:     template.Must(template.ParseFiles(fmt.Sprintf("%s/%s", templatePath, "home.html"))),
+		mistypedTemplate: template.Must(template.ParseFiles(fmt.Sprintf("%s/%s", templatePath, "mistyped.html"))),
+		iconPath:         fmt.Sprintf("%s/%s", templatePath, "u.png"),
+		logger:           logger,
 	}
 }
 
@@ -28,6 +30,17 @@ func (r *Render) Home(w http.ResponseWriter) {
 	}
 }
 
+// Mistyped renders the not found page for codes with invalid check digit
+func (r *Render) Mistyped(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+
+	err := r.mistypedTemplate.Execute(w, struct{ Code string }{Code: code})
+	if err != nil {
+		r.logger.Error("can not execute mistyped page", slog.String("error", err.Error()))
+	}
+}
+
 func (r *Render) Icon(w http.ResponseWriter, res *http.Request) {
 	http.ServeFile(w, res, r.iconPath)
 }
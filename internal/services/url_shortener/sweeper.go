@@ -0,0 +1,54 @@
+package url_shortener
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Sweeper periodically purges expired links.
+// Links are kept for the retention period after expiration,
+// so that they are served as gone instead of not found for a while.
+type Sweeper struct {
+	logger    *slog.Logger
+	shortener *URLShortener
+	interval  time.Duration
+	retention time.Duration
+}
+
+func NewSweeper(logger *slog.Logger, shortener *URLShortener, interval, retention time.Duration) *Sweeper {
+	return &Sweeper{
+		logger:    logger,
+		shortener: shortener,
+		interval:  interval,
+		retention: retention,
+	}
+}
+
+// Run sweeps expired links every interval until the context is done.
+func (s *Sweeper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+func (s *Sweeper) sweep(ctx context.Context) {
+	purged, err := s.shortener.PurgeExpired(ctx, time.Now().Add(-s.retention))
+	if err != nil {
+		s.logger.Error("failed to purge expired links", slog.Int("purged", purged), slog.String("error", err.Error()))
+		return
+	}
+
+	if purged > 0 {
+		s.logger.Info("purged expired links", slog.Int("count", purged))
+	}
+}
@@ -3,74 +3,758 @@ package url_shortener
 import (
 	"context"
 	"errors"
+	"golang.org/x/sync/singleflight"
 	"log/slog"
+	"slices"
+	"sync/atomic"
+	"time"
 	"url-shortner/internal/domain"
 )
 
+const (
+	// maxCodeAttempts limits the number of generated codes tried on collision
+	maxCodeAttempts = 5
+
+	filterBatchSize = 10000
+	exportBatchSize = 1000
+	purgeBatchSize  = 1000
+)
+
+// Cache returns domain.ErrURLNotFound for codes stored with StoreMissing
+// Codes passed to PublishCreated are added to filters of all replicas.
 type Cache interface {
-	QueryLinkByID(ctx context.Context, id int) (string, error)
+	QueryLink(ctx context.Context, code string) (*domain.Link, error)
 	StoreLink(ctx context.Context, link *domain.Link) error
+	StoreMissing(ctx context.Context, code string) error
+	DeleteLinks(ctx context.Context, codes ...string) error
+	PublishCreated(ctx context.Context, codes ...string) error
 }
 
 type DB interface {
-	GetByID(ctx context.Context, id int) (*domain.Link, error)
-	GetByURL(ctx context.Context, url string) (*domain.Link, error)
-	PersistURL(ctx context.Context, url string) (*domain.Link, error)
+	GetByCode(ctx context.Context, code string) (*domain.Link, error)
+	GetByURL(ctx context.Context, canonicalURL string) (*domain.Link, error)
+	NextID(ctx context.Context) (int, error)
+	NextIDs(ctx context.Context, n int) ([]int, error)
+	PersistURL(ctx context.Context, link *domain.Link) (*domain.Link, error)
+	PersistURLs(ctx context.Context, links []*domain.Link) ([]*domain.Link, error)
+	TakenCodes(ctx context.Context, codes []string) ([]string, error)
+	ImportURLs(ctx context.Context, links []*domain.Link) ([]*domain.Link, error)
+	ExportLinks(ctx context.Context, batchSize int, fn func(link *domain.Link) error) error
+	List(ctx context.Context, filter *domain.LinkFilter) ([]*domain.Link, error)
+	UpdateURL(ctx context.Context, code string, url, canonicalURL string) (*domain.Link, error)
+	Delete(ctx context.Context, code string) (*domain.Link, error)
+	DeleteExpired(ctx context.Context, before time.Time, limit int) ([]*domain.Link, error)
+	ListWithoutCode(ctx context.Context, afterID, limit int) ([]*domain.Link, error)
+	ListCodes(ctx context.Context, afterID, limit int) ([]*domain.Link, error)
+	ListTop(ctx context.Context, order domain.LinkOrder, after *domain.Link, limit int) ([]*domain.Link, error)
+	SetCodes(ctx context.Context, links []*domain.Link) (int64, error)
+}
+
+type Generator interface {
+	Generate(link *domain.Link, attempt int) (string, error)
+}
+
+// Canonicalizer turns urls pointing to the same page into the same string
+type Canonicalizer interface {
+	Canonical(url string) string
+}
+
+// Filter tells codes which definitely don't exist
+type Filter interface {
+	Add(code string)
+	MayContain(code string) bool
+}
+
+type HitCounter interface {
+	Hit(id int)
+	Pending(id int) int64
 }
 
 type URLShortener struct {
-	logger *slog.Logger
-	cache  Cache
-	db     DB
+	logger    *slog.Logger
+	cache     Cache
+	db        DB
+	generator Generator
+	hits      HitCounter
+	canonical Canonicalizer
+
+	// loads collapses concurrent cache misses of the same code into a single DB query
+	loads singleflight.Group
+	// changes counts updates and deletes, so that loads racing with them don't leave stale links cached
+	changes atomic.Int64
+
+	// filter is optional, it is only consulted while it holds all existing codes
+	filter      Filter
+	filterReady atomic.Bool
+	// filterBuilds counts started builds, so that only the latest one marks the filter ready
+	filterBuilds atomic.Int64
 }
 
-func New(logger *slog.Logger, cache Cache, db DB) *URLShortener {
+func New(logger *slog.Logger, cache Cache, db DB, generator Generator, hits HitCounter, canonical Canonicalizer, filter Filter) *URLShortener {
 	return &URLShortener{
-		logger: logger,
-		cache:  cache,
-		db:     db,
+		logger:    logger,
+		cache:     cache,
+		db:        db,
+		generator: generator,
+		hits:      hits,
+		canonical: canonical,
+		filter:    filter,
 	}
 }
 
-func (u *URLShortener) Proxy(ctx context.Context, id int) (string, error) {
+func (u *URLShortener) Proxy(ctx context.Context, code string) (*domain.Link, error) {
+	// codes missing from the filter definitely don't exist
+	if u.filter != nil && u.filterReady.Load() && !u.filter.MayContain(code) {
+		return nil, domain.ErrURLNotFound
+	}
+
 	// first check if the link exists in Redis
-	redisLink, err := u.cache.QueryLinkByID(ctx, id)
+	redisLink, err := u.cache.QueryLink(ctx, code)
 	if err == nil {
+		u.hits.Hit(redisLink.ID)
 		return redisLink, nil
 	}
 
+	// the code is known to be missing
+	if errors.Is(err, domain.ErrURLNotFound) {
+		return nil, err
+	}
+
 	// link not found on Redis.
-	// So, let's query the DB
-	dbLink, err := u.db.GetByID(ctx, id)
+	// So, let's query the DB, once for all concurrent requests of the code.
+	// The load is not canceled with the request, since other requests may wait for it.
+	loaded := u.loads.DoChan(code, func() (any, error) {
+		return u.load(context.WithoutCancel(ctx), code)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-loaded:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		// every request gets its own copy of the shared link
+		dbLink := *res.Val.(*domain.Link)
+		u.hits.Hit(dbLink.ID)
+
+		return &dbLink, nil
+	}
+}
+
+// load reads the link from the DB and stores it on Redis
+func (u *URLShortener) load(ctx context.Context, code string) (*domain.Link, error) {
+	changes := u.changes.Load()
+
+	dbLink, err := u.db.GetByCode(ctx, code)
+	if errors.Is(err, domain.ErrURLNotFound) {
+		// remember the missing code for a while, so that scanning bots don't reach the DB
+		u.logCacheError(u.cache.StoreMissing(ctx, code))
+
+		return nil, err
+	}
+
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	if dbLink.Expired(time.Now()) {
+		return nil, domain.ErrURLGone
 	}
 
 	// store the link on Redis
-	err = u.cache.StoreLink(ctx, dbLink)
+	u.logCacheError(u.cache.StoreLink(ctx, dbLink))
+
+	// the link may have been changed after it was read, then the stored one may be stale
+	if u.changes.Load() != changes {
+		u.invalidate(ctx, code)
+	}
+
+	return dbLink, nil
+}
+
+func (u *URLShortener) Create(ctx context.Context, link *domain.Link) (*domain.Link, error) {
+	canonicalLink := *link
+	canonicalLink.CanonicalURL = u.canonical.Canonical(link.URL)
+	link = &canonicalLink
+
+	// links with alias, expiration or redirect type are always new
+	if link.Dedupable() {
+		// check if link already exists on database
+		storedLink, err := u.db.GetByURL(ctx, link.CanonicalURL)
+		if err == nil {
+			return storedLink, nil
+		}
+
+		if !errors.Is(err, domain.ErrURLNotFound) {
+			return nil, err
+		}
+	}
+
+	// It's a new link, so let's persist it
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		newLink, err := u.persist(ctx, link, attempt)
+		if err == nil {
+			// new links are cached right away, which also replaces the code cached as missing
+			u.logCacheError(u.cache.StoreLink(ctx, newLink))
+			u.addCreated(ctx, []string{newLink.Code})
+
+			return newLink, nil
+		}
+
+		if !errors.Is(err, domain.ErrCodeTaken) {
+			return nil, err
+		}
+
+		if link.Alias != "" {
+			return nil, domain.ErrAliasTaken
+		}
+
+		u.logger.Warn("short code collision", slog.Int("attempt", attempt))
+	}
+
+	return nil, domain.ErrCodesExhausted
+}
+
+// CreateBatch creates the links of a batch, all links of an attempt are stored by a single insert.
+// Results are reported per link: links with taken aliases fail with domain.ErrAliasTaken, while others are still created.
+// Links which may be deduplicated share the link for the same url, within the batch too.
+// It returns an error only if the batch can't be stored at all.
+func (u *URLShortener) CreateBatch(ctx context.Context, links []*domain.Link) ([]domain.LinkResult, error) {
+	results := make([]domain.LinkResult, len(links))
+	batch := make([]*domain.Link, len(links))
+
+	// the batch can't insert two links for the same url, so later ones share the result of the first one
+	firstByURL := make(map[string]int)
+	shared := make(map[int]int)
+	aliases := make(map[string]struct{})
+
+	pending := make([]int, 0, len(links))
+	for i, link := range links {
+		canonicalLink := *link
+		canonicalLink.CanonicalURL = u.canonical.Canonical(link.URL)
+		batch[i] = &canonicalLink
+
+		if canonicalLink.Dedupable() {
+			if first, ok := firstByURL[canonicalLink.CanonicalURL]; ok {
+				shared[i] = first
+				continue
+			}
+
+			firstByURL[canonicalLink.CanonicalURL] = i
+		}
+
+		if link.Alias != "" {
+			if _, ok := aliases[link.Alias]; ok {
+				results[i].Err = domain.ErrAliasTaken
+				continue
+			}
+
+			aliases[link.Alias] = struct{}{}
+		}
+
+		pending = append(pending, i)
+	}
+
+	var err error
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt == maxCodeAttempts {
+			for _, i := range pending {
+				results[i].Err = domain.ErrCodesExhausted
+			}
+
+			break
+		}
+
+		pending, err = u.persistBatch(ctx, batch, pending, results, attempt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	codes := make([]string, 0, len(links))
+	for i := range results {
+		if first, ok := shared[i]; ok {
+			results[i] = results[first]
+			continue
+		}
+
+		if results[i].Link != nil {
+			codes = append(codes, results[i].Link.Code)
+			u.logCacheError(u.cache.StoreLink(ctx, results[i].Link))
+		}
+	}
+
+	u.addCreated(ctx, codes)
+
+	return results, nil
+}
+
+// Import stores the links of a batch under their own codes, which links of another shortener have.
+// Links conflicting with existing codes or aliases fail with domain.ErrCodeTaken, links without code are created like by CreateBatch
+// and start without clicks.
+// It returns an error only if the batch can't be stored at all.
+func (u *URLShortener) Import(ctx context.Context, links []*domain.Link) ([]domain.LinkResult, error) {
+	results := make([]domain.LinkResult, len(links))
+
+	coded := make([]*domain.Link, 0, len(links))
+	codedIndexes := make([]int, 0, len(links))
+	generated := make([]*domain.Link, 0, len(links))
+	generatedIndexes := make([]int, 0, len(links))
+	for i, link := range links {
+		if link.Code == "" {
+			generated = append(generated, link)
+			generatedIndexes = append(generatedIndexes, i)
+			continue
+		}
+
+		coded = append(coded, link)
+		codedIndexes = append(codedIndexes, i)
+	}
+
+	if len(coded) > 0 {
+		ids, err := u.db.NextIDs(ctx, len(coded))
+		if err != nil {
+			return nil, err
+		}
+
+		newLinks := make([]*domain.Link, 0, len(coded))
+		for n, link := range coded {
+			newLink := *link
+			newLink.ID = ids[n]
+			newLink.CanonicalURL = u.canonical.Canonical(link.URL)
+			newLinks = append(newLinks, &newLink)
+		}
+
+		imported, err := u.db.ImportURLs(ctx, newLinks)
+		if err != nil {
+			return nil, err
+		}
+
+		// links which are not returned conflict with existing ones or with earlier links of the batch
+		byID := make(map[int]*domain.Link, len(imported))
+		codes := make([]string, 0, len(imported))
+		for _, link := range imported {
+			byID[link.ID] = link
+			codes = append(codes, link.Code)
+			u.logCacheError(u.cache.StoreLink(ctx, link))
+		}
+
+		u.addCreated(ctx, codes)
+
+		for n, i := range codedIndexes {
+			link, ok := byID[newLinks[n].ID]
+			if !ok {
+				results[i].Err = domain.ErrCodeTaken
+				continue
+			}
+
+			results[i].Link = link
+		}
+	}
+
+	if len(generated) > 0 {
+		created, err := u.CreateBatch(ctx, generated)
+		if err != nil {
+			return nil, err
+		}
+
+		for n, i := range generatedIndexes {
+			results[i] = created[n]
+		}
+	}
+
+	return results, nil
+}
+
+// Export passes all links to fn, counting the clicks which are not flushed to the DB yet.
+// It stops with the error returned by fn.
+func (u *URLShortener) Export(ctx context.Context, fn func(link *domain.Link) error) error {
+	return u.db.ExportLinks(ctx, exportBatchSize, func(link *domain.Link) error {
+		link.Clicks += u.hits.Pending(link.ID)
+
+		return fn(link)
+	})
+}
+
+// persistBatch stores the pending links of the batch under new ids and codes, setting their results.
+// It returns the links which have to be tried again with other codes.
+func (u *URLShortener) persistBatch(ctx context.Context, batch []*domain.Link, pending []int, results []domain.LinkResult, attempt int) ([]int, error) {
+	ids, err := u.db.NextIDs(ctx, len(pending))
 	if err != nil {
-		u.logger.Error("cache error", slog.String("message", err.Error()))
+		return nil, err
+	}
+
+	// aliases are reserved first, so that generated codes never take them
+	codes := make(map[string]struct{}, len(pending))
+	for _, i := range pending {
+		if batch[i].Alias != "" {
+			codes[batch[i].Alias] = struct{}{}
+		}
+	}
+
+	var retry []int
+	newLinks := make([]*domain.Link, 0, len(pending))
+	indexes := make([]int, 0, len(pending))
+	for n, i := range pending {
+		newLink := *batch[i]
+		newLink.ID = ids[n]
+		newLink.Code = newLink.Alias
+
+		if newLink.Code == "" {
+			newLink.Code, err = u.generator.Generate(&newLink, attempt)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, ok := codes[newLink.Code]; ok {
+				retry = append(retry, i)
+				continue
+			}
+
+			codes[newLink.Code] = struct{}{}
+		}
+
+		newLinks = append(newLinks, &newLink)
+		indexes = append(indexes, i)
+	}
+
+	// links with taken codes are left out, so that the rest of the batch is stored
+	newCodes := make([]string, 0, len(newLinks))
+	for _, newLink := range newLinks {
+		newCodes = append(newCodes, newLink.Code)
+	}
+
+	taken, err := u.db.TakenCodes(ctx, newCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	storeLinks := make([]*domain.Link, 0, len(newLinks))
+	storeIndexes := make([]int, 0, len(newLinks))
+	for n, newLink := range newLinks {
+		i := indexes[n]
+
+		switch {
+		case !slices.Contains(taken, newLink.Code):
+			storeLinks = append(storeLinks, newLink)
+			storeIndexes = append(storeIndexes, i)
+		case newLink.Alias != "":
+			results[i].Err = domain.ErrAliasTaken
+		default:
+			retry = append(retry, i)
+		}
+	}
+
+	if len(retry) > 0 {
+		u.logger.Warn("short code collision", slog.Int("attempt", attempt), slog.Int("links", len(retry)))
+	}
+
+	if len(storeLinks) == 0 {
+		return retry, nil
+	}
+
+	stored, err := u.db.PersistURLs(ctx, storeLinks)
+	if errors.Is(err, domain.ErrCodeTaken) {
+		// another request took one of the codes meanwhile, the taken codes are found on the next attempt
+		return append(retry, storeIndexes...), nil
 	}
 
-	return dbLink.URL, nil
+	if err != nil {
+		return nil, err
+	}
+
+	for n, i := range storeIndexes {
+		results[i].Link = stored[n]
+	}
+
+	return retry, nil
 }
 
-func (u *URLShortener) Create(ctx context.Context, url string) (*domain.Link, error) {
-	// check if link already exists on database
-	storedLink, err := u.db.GetByURL(ctx, url)
-	if err == nil {
-		return storedLink, nil
+// persist stores the link under a new id and a code, which is either the alias or a generated one.
+func (u *URLShortener) persist(ctx context.Context, link *domain.Link, attempt int) (*domain.Link, error) {
+	id, err := u.db.NextID(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	if !errors.Is(err, domain.ErrURLNotFound) {
+	newLink := *link
+	newLink.ID = id
+	newLink.Code = link.Alias
+
+	if newLink.Code == "" {
+		newLink.Code, err = u.generator.Generate(&newLink, attempt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return u.db.PersistURL(ctx, &newLink)
+}
+
+func (u *URLShortener) Get(ctx context.Context, code string) (*domain.Link, error) {
+	return u.db.GetByCode(ctx, code)
+}
+
+// Stats returns the link with the total number of clicks,
+// including the clicks which are not flushed to the DB yet.
+func (u *URLShortener) Stats(ctx context.Context, code string) (*domain.Link, error) {
+	link, err := u.db.GetByCode(ctx, code)
+	if err != nil {
 		return nil, err
 	}
 
-	// It's a new link, so let's persist it
-	newLink, err := u.db.PersistURL(ctx, url)
+	link.Clicks += u.hits.Pending(link.ID)
+
+	return link, nil
+}
+
+// List returns a page of links matching the filter.
+// It also reports whether there are more links after the page.
+func (u *URLShortener) List(ctx context.Context, filter *domain.LinkFilter) ([]*domain.Link, bool, error) {
+	// fetch one extra link to find out if there is a next page
+	page := *filter
+	page.Limit++
+
+	links, err := u.db.List(ctx, &page)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(links) > filter.Limit {
+		return links[:filter.Limit], true, nil
+	}
+
+	return links, false, nil
+}
+
+// UpdateURL changes the destination of the link.
+// The cached destination is dropped, so that Proxy never serves a stale one.
+func (u *URLShortener) UpdateURL(ctx context.Context, code string, url string) (*domain.Link, error) {
+	u.beginChange(ctx, code)
+
+	link, err := u.db.UpdateURL(ctx, code, url, u.canonical.Canonical(url))
 	if err != nil {
 		return nil, err
 	}
 
-	return newLink, nil
+	u.endChange(ctx, code)
+
+	return link, nil
+}
+
+// Delete removes the link together with its cached destination.
+func (u *URLShortener) Delete(ctx context.Context, code string) error {
+	u.beginChange(ctx, code)
+
+	_, err := u.db.Delete(ctx, code)
+	if err != nil {
+		return err
+	}
+
+	u.endChange(ctx, code)
+
+	return nil
+}
+
+// beginChange drops the link before it is changed in the DB, loads of this replica which read it before
+// drop it again once they cached it. Loads of other replicas are covered by endChange.
+func (u *URLShortener) beginChange(ctx context.Context, code string) {
+	u.changes.Add(1)
+	u.invalidate(ctx, code)
+}
+
+// endChange drops the link cached while it was changed in the DB,
+// and requests after the change don't join loads which may have read it before.
+func (u *URLShortener) endChange(ctx context.Context, code string) {
+	u.loads.Forget(code)
+	u.invalidate(ctx, code)
+}
+
+// PurgeExpired removes links which expired before the given time in batches
+// and drops them from the cache, so that their aliases can be reused.
+// It returns the number of removed links, which is also returned with an error of a later batch.
+func (u *URLShortener) PurgeExpired(ctx context.Context, before time.Time) (int, error) {
+	purged := 0
+
+	for {
+		links, err := u.db.DeleteExpired(ctx, before, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		codes := make([]string, 0, len(links))
+		for _, link := range links {
+			codes = append(codes, link.Code)
+		}
+
+		u.invalidate(ctx, codes...)
+		purged += len(links)
+
+		if len(links) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// BackfillCodes stores codes of the links created before codes were stored.
+// The codes are produced by the legacy generator, which derives them from link ids,
+// so that the links keep resolving under the codes they were published with.
+func (u *URLShortener) BackfillCodes(ctx context.Context, legacy Generator, batchSize int) error {
+	afterID := 0
+
+	for {
+		links, err := u.db.ListWithoutCode(ctx, afterID, batchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(links) == 0 {
+			return nil
+		}
+
+		for _, link := range links {
+			link.Code, err = legacy.Generate(link, 0)
+			if err != nil {
+				return err
+			}
+		}
+
+		updated, err := u.db.SetCodes(ctx, links)
+		if err != nil {
+			return err
+		}
+
+		if skipped := int64(len(links)) - updated; skipped > 0 {
+			u.logger.Warn("links are shadowed by aliases and left without code", slog.Int64("count", skipped))
+		}
+
+		afterID = links[len(links)-1].ID
+	}
+}
+
+// Warmup stores up to size links in the given order into the cache.
+// wait is called before every batch of links is read, so that the caller can limit the rate.
+// It returns the number of stored links.
+func (u *URLShortener) Warmup(ctx context.Context, order domain.LinkOrder, size int, wait func(ctx context.Context, n int) error) (int, error) {
+	warmed := 0
+	var last *domain.Link
+
+	for warmed < size {
+		batch := min(warmupBatchSize, size-warmed)
+
+		err := wait(ctx, batch)
+		if err != nil {
+			return warmed, err
+		}
+
+		links, err := u.db.ListTop(ctx, order, last, batch)
+		if err != nil {
+			return warmed, err
+		}
+
+		for _, link := range links {
+			err = u.cache.StoreLink(ctx, link)
+			if err != nil {
+				return warmed, err
+			}
+		}
+
+		warmed += len(links)
+
+		if len(links) < batch {
+			break
+		}
+
+		last = links[len(links)-1]
+	}
+
+	return warmed, nil
+}
+
+// BuildFilter adds codes of all links to the filter, which is consulted by Proxy afterwards.
+// It should run after subscribing to codes created by other replicas: links committed after
+// the scan passed their ids are only learnt from the subscription.
+func (u *URLShortener) BuildFilter(ctx context.Context) error {
+	if u.filter == nil {
+		return nil
+	}
+
+	build := u.filterBuilds.Add(1)
+	u.filterReady.Store(false)
+
+	afterID := 0
+
+	for {
+		links, err := u.db.ListCodes(ctx, afterID, filterBatchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(links) == 0 {
+			// codes may have been missed since a later build started, which marks the filter ready instead
+			if u.filterBuilds.Load() == build {
+				u.filterReady.Store(true)
+			}
+
+			return nil
+		}
+
+		for _, link := range links {
+			u.filter.Add(link.Code)
+		}
+
+		afterID = links[len(links)-1].ID
+	}
+}
+
+// AddCodes adds codes of links created by this or another replica to the filter.
+// nil codes mean that some codes may have been missed, so the filter is built again,
+// which is also how it is built first, once subscribed to codes of other replicas.
+func (u *URLShortener) AddCodes(codes []string) {
+	if u.filter == nil {
+		return
+	}
+
+	if codes == nil {
+		go func() {
+			err := u.BuildFilter(context.Background())
+			if err != nil {
+				u.logger.Error("failed to build filter", slog.String("error", err.Error()))
+			}
+		}()
+
+		return
+	}
+
+	for _, code := range codes {
+		u.filter.Add(code)
+	}
+}
+
+// addCreated adds codes of new links to the filter of this replica and publishes them to other replicas.
+// Deduplicated links are published again, which is harmless.
+func (u *URLShortener) addCreated(ctx context.Context, codes []string) {
+	if len(codes) == 0 {
+		return
+	}
+
+	u.AddCodes(codes)
+	u.logCacheError(u.cache.PublishCreated(ctx, codes...))
+}
+
+func (u *URLShortener) invalidate(ctx context.Context, codes ...string) {
+	if len(codes) == 0 {
+		return
+	}
+
+	u.logCacheError(u.cache.DeleteLinks(ctx, codes...))
+}
+
+// logCacheError logs failed cache calls, the cache is bypassed silently while it is unavailable
+func (u *URLShortener) logCacheError(err error) {
+	if err != nil && !errors.Is(err, domain.ErrCacheUnavailable) {
+		u.logger.Error("cache error", slog.String("message", err.Error()))
+	}
 }
@@ -0,0 +1,868 @@
+package url_shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+	"url-shortner/internal/domain"
+	"url-shortner/internal/services/canonical"
+	"url-shortner/internal/services/encoder"
+	"url-shortner/pkg/bloom"
+	"url-shortner/pkg/logger/slogdiscard"
+)
+
+type fakeCache struct {
+	mu      sync.Mutex
+	links   map[string]*domain.Link
+	stores  int
+	missing map[string]struct{}
+	created []string
+}
+
+func newFakeCache() *fakeCache {
+	return &fakeCache{links: make(map[string]*domain.Link), missing: make(map[string]struct{})}
+}
+
+func (c *fakeCache) QueryLink(_ context.Context, code string) (*domain.Link, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.missing[code]; ok {
+		return nil, domain.ErrURLNotFound
+	}
+
+	link, ok := c.links[code]
+	if !ok {
+		return nil, errors.New("key does not exists")
+	}
+
+	return link, nil
+}
+
+func (c *fakeCache) StoreLink(_ context.Context, link *domain.Link) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stores++
+	c.links[link.Code] = link
+	delete(c.missing, link.Code)
+	return nil
+}
+
+func (c *fakeCache) StoreMissing(_ context.Context, code string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.missing[code] = struct{}{}
+	return nil
+}
+
+func (c *fakeCache) PublishCreated(_ context.Context, codes ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.created = append(c.created, codes...)
+	return nil
+}
+
+func (c *fakeCache) DeleteLinks(_ context.Context, codes ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, code := range codes {
+		delete(c.links, code)
+		delete(c.missing, code)
+	}
+
+	return nil
+}
+
+type fakeDB struct {
+	mu      sync.Mutex
+	lastID  int
+	links   map[string]*domain.Link
+	queries int
+	// release blocks GetByCode until closed, if set
+	release chan struct{}
+	// afterGet is called once GetByCode has read the link, if set
+	afterGet func()
+	deletes  int
+}
+
+func newFakeDB(links ...*domain.Link) *fakeDB {
+	db := &fakeDB{links: make(map[string]*domain.Link)}
+	for _, link := range links {
+		if link.CanonicalURL == "" {
+			link.CanonicalURL = link.URL
+		}
+
+		db.links[link.Code] = link
+		db.lastID = max(db.lastID, link.ID)
+	}
+
+	return db
+}
+
+func (db *fakeDB) GetByCode(_ context.Context, code string) (*domain.Link, error) {
+	if db.release != nil {
+		<-db.release
+	}
+
+	db.mu.Lock()
+	db.queries++
+	link, ok := db.links[code]
+	if ok {
+		copied := *link
+		link = &copied
+	}
+	db.mu.Unlock()
+
+	if db.afterGet != nil {
+		db.afterGet()
+	}
+
+	if !ok {
+		return nil, domain.ErrURLNotFound
+	}
+
+	return link, nil
+}
+
+func (db *fakeDB) GetByURL(_ context.Context, canonicalURL string) (*domain.Link, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, link := range db.links {
+		if link.CanonicalURL == canonicalURL && link.Dedupable() {
+			return link, nil
+		}
+	}
+
+	return nil, domain.ErrURLNotFound
+}
+
+func (db *fakeDB) NextID(context.Context) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.lastID++
+	return db.lastID, nil
+}
+
+// PersistURL returns the existing link for the url like the unique url hash does
+func (db *fakeDB) PersistURL(_ context.Context, link *domain.Link) (*domain.Link, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if link.Dedupable() {
+		for _, stored := range db.links {
+			if stored.CanonicalURL == link.CanonicalURL && stored.Dedupable() {
+				return stored, nil
+			}
+		}
+	}
+
+	if _, ok := db.links[link.Code]; ok {
+		return nil, domain.ErrCodeTaken
+	}
+
+	db.links[link.Code] = link
+	return link, nil
+}
+
+func (db *fakeDB) NextIDs(_ context.Context, n int) ([]int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	ids := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		db.lastID++
+		ids = append(ids, db.lastID)
+	}
+
+	return ids, nil
+}
+
+func (db *fakeDB) TakenCodes(_ context.Context, codes []string) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var taken []string
+	for _, code := range codes {
+		if _, ok := db.links[code]; ok {
+			taken = append(taken, code)
+		}
+	}
+
+	return taken, nil
+}
+
+// PersistURLs stores either all links or none of them like a single insert does
+func (db *fakeDB) PersistURLs(_ context.Context, links []*domain.Link) ([]*domain.Link, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, link := range links {
+		if _, ok := db.links[link.Code]; ok {
+			return nil, domain.ErrCodeTaken
+		}
+	}
+
+	// like the insert, only links which may be deduplicated are matched to existing ones by the canonical url
+	byURL := make(map[string]*domain.Link)
+	for _, existing := range db.links {
+		if existing.Dedupable() {
+			byURL[existing.CanonicalURL] = existing
+		}
+	}
+
+	stored := make([]*domain.Link, 0, len(links))
+	for _, link := range links {
+		storedLink, ok := byURL[link.CanonicalURL]
+		if !ok || !link.Dedupable() {
+			storedLink = link
+			db.links[link.Code] = link
+		}
+
+		stored = append(stored, storedLink)
+	}
+
+	return stored, nil
+}
+
+// ImportURLs skips links with taken codes like the insert ignoring conflicts does
+func (db *fakeDB) ImportURLs(_ context.Context, links []*domain.Link) ([]*domain.Link, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	imported := make([]*domain.Link, 0, len(links))
+	for _, link := range links {
+		if _, ok := db.links[link.Code]; ok {
+			continue
+		}
+
+		db.links[link.Code] = link
+		imported = append(imported, link)
+	}
+
+	return imported, nil
+}
+
+func (db *fakeDB) ExportLinks(_ context.Context, _ int, fn func(link *domain.Link) error) error {
+	db.mu.Lock()
+	links := make([]*domain.Link, 0, len(db.links))
+	for _, link := range db.links {
+		copied := *link
+		links = append(links, &copied)
+	}
+	db.mu.Unlock()
+
+	slices.SortFunc(links, func(a, b *domain.Link) int { return a.ID - b.ID })
+	for _, link := range links {
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *fakeDB) List(context.Context, *domain.LinkFilter) ([]*domain.Link, error) {
+	return nil, nil
+}
+
+func (db *fakeDB) UpdateURL(_ context.Context, code string, url, canonicalURL string) (*domain.Link, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	link, ok := db.links[code]
+	if !ok {
+		return nil, domain.ErrURLNotFound
+	}
+
+	link.URL = url
+	link.CanonicalURL = canonicalURL
+	return link, nil
+}
+
+func (db *fakeDB) Delete(_ context.Context, code string) (*domain.Link, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	link, ok := db.links[code]
+	if !ok {
+		return nil, domain.ErrURLNotFound
+	}
+
+	delete(db.links, code)
+	return link, nil
+}
+
+func (db *fakeDB) DeleteExpired(_ context.Context, before time.Time, limit int) ([]*domain.Link, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.deletes++
+
+	var deleted []*domain.Link
+	for code, link := range db.links {
+		if len(deleted) == limit {
+			break
+		}
+
+		if link.ExpiresOn != nil && link.ExpiresOn.Before(before) {
+			deleted = append(deleted, link)
+			delete(db.links, code)
+		}
+	}
+
+	return deleted, nil
+}
+
+func (db *fakeDB) ListWithoutCode(context.Context, int, int) ([]*domain.Link, error) {
+	return nil, nil
+}
+
+func (db *fakeDB) ListCodes(_ context.Context, afterID, _ int) ([]*domain.Link, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// all codes are returned in a single batch
+	if afterID > 0 {
+		return nil, nil
+	}
+
+	links := make([]*domain.Link, 0, len(db.links))
+	for _, link := range db.links {
+		links = append(links, &domain.Link{ID: db.lastID, Code: link.Code})
+	}
+
+	return links, nil
+}
+
+func (db *fakeDB) ListTop(_ context.Context, _ domain.LinkOrder, after *domain.Link, limit int) ([]*domain.Link, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	links := make([]*domain.Link, 0, len(db.links))
+	for _, link := range db.links {
+		if after == nil || link.ID < after.ID {
+			links = append(links, link)
+		}
+	}
+
+	slices.SortFunc(links, func(a, b *domain.Link) int {
+		return b.ID - a.ID
+	})
+
+	return links[:min(limit, len(links))], nil
+}
+
+func (db *fakeDB) SetCodes(context.Context, []*domain.Link) (int64, error) {
+	return 0, nil
+}
+
+// fakeGenerator returns the given codes one by one
+type fakeGenerator struct {
+	codes []string
+}
+
+func (g *fakeGenerator) Generate(_ *domain.Link, attempt int) (string, error) {
+	return g.codes[attempt], nil
+}
+
+// idGenerator derives codes from link ids
+type idGenerator struct{}
+
+func (idGenerator) Generate(link *domain.Link, _ int) (string, error) {
+	return fmt.Sprintf("code%d", link.ID), nil
+}
+
+type fakeHits struct{}
+
+func (fakeHits) Hit(int) {}
+
+func (fakeHits) Pending(int) int64 {
+	return 0
+}
+
+func newTestShortener(db DB, generator Generator) *URLShortener {
+	return New(slogdiscard.NewDiscardLogger(), newFakeCache(), db, generator, fakeHits{}, canonical.New(true), nil)
+}
+
+func TestURLShortener_CreateRetriesOnCollision(t *testing.T) {
+	db := newFakeDB(&domain.Link{ID: 1, Code: "taken", URL: "https://example.com/first"})
+	shortener := newTestShortener(db, &fakeGenerator{codes: []string{"taken", "free"}})
+
+	link, err := shortener.Create(context.Background(), &domain.Link{URL: "https://example.com/second"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "free", link.Code)
+	assert.Equal(t, "https://example.com/second", link.URL)
+}
+
+func TestURLShortener_CreateCodesExhausted(t *testing.T) {
+	db := newFakeDB(&domain.Link{ID: 1, Code: "taken", URL: "https://example.com/first"})
+	codes := make([]string, maxCodeAttempts)
+	for i := range codes {
+		codes[i] = "taken"
+	}
+	shortener := newTestShortener(db, &fakeGenerator{codes: codes})
+
+	_, err := shortener.Create(context.Background(), &domain.Link{URL: "https://example.com/second"})
+
+	assert.ErrorIs(t, err, domain.ErrCodesExhausted)
+}
+
+func TestURLShortener_CreateHashedNotDeduplicated(t *testing.T) {
+	generator, err := encoder.NewHash(encoder.New(), 7)
+	require.NoError(t, err)
+
+	db := newFakeDB()
+	shortener := newTestShortener(db, generator)
+
+	// links with redirect type are not deduplicated, so every one of them needs another code
+	for i := 0; i < 2*maxCodeAttempts; i++ {
+		_, err := shortener.Create(context.Background(), &domain.Link{URL: "https://example.com/same", RedirectType: 301})
+		require.NoError(t, err, i)
+	}
+
+	assert.Len(t, db.links, 2*maxCodeAttempts)
+}
+
+func TestURLShortener_CreateAliasTaken(t *testing.T) {
+	db := newFakeDB(&domain.Link{ID: 1, Code: "launch", URL: "https://example.com/first"})
+	shortener := newTestShortener(db, &fakeGenerator{})
+
+	_, err := shortener.Create(context.Background(), &domain.Link{URL: "https://example.com/second", Alias: "launch"})
+
+	assert.ErrorIs(t, err, domain.ErrAliasTaken)
+}
+
+func TestURLShortener_CreateAliasLikeCode(t *testing.T) {
+	db := newFakeDB()
+	shortener := newTestShortener(db, &fakeGenerator{codes: []string{"42", "43"}})
+
+	// aliases may look like codes, a generated code colliding with the alias is retried
+	aliased, err := shortener.Create(context.Background(), &domain.Link{URL: "https://example.com/first", Alias: "42"})
+	require.NoError(t, err)
+	assert.Equal(t, "42", aliased.Code)
+
+	generated, err := shortener.Create(context.Background(), &domain.Link{URL: "https://example.com/second"})
+	require.NoError(t, err)
+	assert.Equal(t, "43", generated.Code)
+}
+
+func TestURLShortener_CreateDeduplicates(t *testing.T) {
+	db := newFakeDB(&domain.Link{ID: 1, Code: "b", URL: "https://example.com/first"})
+	shortener := newTestShortener(db, &fakeGenerator{})
+
+	link, err := shortener.Create(context.Background(), &domain.Link{URL: "https://example.com/first"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "b", link.Code)
+}
+
+func TestURLShortener_CreateDeduplicatesCanonical(t *testing.T) {
+	db := newFakeDB()
+	shortener := newTestShortener(db, &fakeGenerator{codes: []string{"first", "second"}})
+
+	first, err := shortener.Create(context.Background(), &domain.Link{URL: "http://Example.com:80/a?b=1&a=2&utm_source=mail#top"})
+	require.NoError(t, err)
+
+	second, err := shortener.Create(context.Background(), &domain.Link{URL: "http://example.com/a?a=2&b=1"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "first", second.Code)
+	assert.Len(t, db.links, 1)
+
+	// the original url is kept for redirects
+	assert.Equal(t, "http://Example.com:80/a?b=1&a=2&utm_source=mail#top", first.URL)
+	assert.Equal(t, "http://example.com/a?a=2&b=1", first.CanonicalURL)
+}
+
+func TestURLShortener_CreateRedirectTypeNotDeduplicated(t *testing.T) {
+	db := newFakeDB(&domain.Link{ID: 1, Code: "b", URL: "https://example.com/first"})
+	shortener := newTestShortener(db, &fakeGenerator{codes: []string{"permanent"}})
+
+	link, err := shortener.Create(context.Background(), &domain.Link{URL: "https://example.com/first", RedirectType: 301})
+	require.NoError(t, err)
+
+	assert.Equal(t, "permanent", link.Code)
+	assert.Equal(t, 301, link.RedirectType)
+}
+
+func TestURLShortener_CreateBatch(t *testing.T) {
+	db := newFakeDB(
+		&domain.Link{ID: 1, Code: "existing", URL: "https://example.com/existing"},
+		&domain.Link{ID: 2, Code: "taken", URL: "https://example.com/taken"},
+	)
+	cache := newFakeCache()
+	shortener := New(slogdiscard.NewDiscardLogger(), cache, db, idGenerator{}, fakeHits{}, canonical.New(true), nil)
+
+	results, err := shortener.CreateBatch(context.Background(), []*domain.Link{
+		{URL: "https://example.com/new"},
+		{URL: "https://example.com/existing"},
+		{URL: "https://EXAMPLE.com/new"},
+		{URL: "https://example.com/aliased", Alias: "taken"},
+		{URL: "https://example.com/aliased", Alias: "launch"},
+		{URL: "https://example.com/other", Alias: "launch"},
+		{URL: "https://example.com/new", RedirectType: 301},
+		{URL: "https://example.com/existing", Alias: "fresh"},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 8)
+
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, "https://example.com/new", results[0].Link.URL)
+	assert.Equal(t, "existing", results[1].Link.Code)
+	assert.Equal(t, results[0].Link.Code, results[2].Link.Code)
+	assert.ErrorIs(t, results[3].Err, domain.ErrAliasTaken)
+	assert.Equal(t, "launch", results[4].Link.Code)
+	assert.ErrorIs(t, results[5].Err, domain.ErrAliasTaken)
+	assert.NotEqual(t, results[0].Link.Code, results[6].Link.Code)
+	assert.Equal(t, "fresh", results[7].Link.Code)
+
+	assert.Len(t, db.links, 6)
+	assert.Contains(t, cache.links, "launch")
+	assert.Contains(t, cache.created, "launch")
+	assert.Contains(t, cache.created, results[0].Link.Code)
+}
+
+func TestURLShortener_CreateBatchRetriesOnCollision(t *testing.T) {
+	// the first id reserved by the batch is 2, its code is already used
+	db := newFakeDB(&domain.Link{ID: 1, Code: "code2", URL: "https://example.com/first"})
+	shortener := newTestShortener(db, idGenerator{})
+
+	results, err := shortener.CreateBatch(context.Background(), []*domain.Link{
+		{URL: "https://example.com/second"},
+		{URL: "https://example.com/third"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "code4", results[0].Link.Code)
+	assert.Equal(t, "code3", results[1].Link.Code)
+	assert.Len(t, db.links, 3)
+}
+
+func TestURLShortener_Import(t *testing.T) {
+	db := newFakeDB(&domain.Link{ID: 1, Code: "taken", URL: "https://example.com/taken"})
+	cache := newFakeCache()
+	shortener := New(slogdiscard.NewDiscardLogger(), cache, db, idGenerator{}, fakeHits{}, canonical.New(true), nil)
+
+	results, err := shortener.Import(context.Background(), []*domain.Link{
+		{Code: "old1", URL: "https://example.com/taken", Clicks: 10},
+		{Code: "taken", URL: "https://example.com/other"},
+		{Code: "old1", URL: "https://example.com/again"},
+		{URL: "https://example.com/generated"},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+
+	// the code is kept, even though another link has the same url
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, "old1", results[0].Link.Code)
+	assert.Equal(t, int64(10), results[0].Link.Clicks)
+
+	assert.ErrorIs(t, results[1].Err, domain.ErrCodeTaken)
+	assert.ErrorIs(t, results[2].Err, domain.ErrCodeTaken)
+
+	require.NoError(t, results[3].Err)
+	assert.NotEmpty(t, results[3].Link.Code)
+
+	assert.Len(t, db.links, 3)
+	assert.Contains(t, cache.links, "old1")
+	assert.ElementsMatch(t, []string{"old1", results[3].Link.Code}, cache.created)
+}
+
+func TestURLShortener_Export(t *testing.T) {
+	db := newFakeDB(
+		&domain.Link{ID: 2, Code: "second", URL: "https://example.com/second"},
+		&domain.Link{ID: 1, Code: "first", URL: "https://example.com/first"},
+	)
+	shortener := newTestShortener(db, &fakeGenerator{})
+
+	var codes []string
+	err := shortener.Export(context.Background(), func(link *domain.Link) error {
+		codes = append(codes, link.Code)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, codes)
+
+	errStop := errors.New("stop")
+	err = shortener.Export(context.Background(), func(*domain.Link) error { return errStop })
+	assert.ErrorIs(t, err, errStop)
+}
+
+func TestURLShortener_Get(t *testing.T) {
+	shortener := newTestShortener(newFakeDB(&domain.Link{ID: 1, Code: "abc", URL: "https://example.com/first"}), &fakeGenerator{})
+
+	link, err := shortener.Get(context.Background(), "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/first", link.URL)
+
+	_, err = shortener.Get(context.Background(), "missing")
+	assert.ErrorIs(t, err, domain.ErrURLNotFound)
+}
+
+func TestURLShortener_UpdateURL(t *testing.T) {
+	db := newFakeDB(&domain.Link{ID: 1, Code: "abc", URL: "https://example.com/first"})
+	cache := newFakeCache()
+	shortener := New(slogdiscard.NewDiscardLogger(), cache, db, &fakeGenerator{}, fakeHits{}, canonical.New(true), nil)
+
+	_, err := shortener.Proxy(context.Background(), "abc")
+	require.NoError(t, err)
+	require.Contains(t, cache.links, "abc")
+
+	link, err := shortener.UpdateURL(context.Background(), "abc", "https://EXAMPLE.com/second")
+	require.NoError(t, err)
+	assert.Equal(t, "https://EXAMPLE.com/second", link.URL)
+	assert.Equal(t, "https://example.com/second", link.CanonicalURL)
+
+	// the stale destination is dropped from the cache, so that the next redirect reads the new one
+	assert.NotContains(t, cache.links, "abc")
+
+	link, err = shortener.Proxy(context.Background(), "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://EXAMPLE.com/second", link.URL)
+
+	_, err = shortener.UpdateURL(context.Background(), "missing", "https://example.com/second")
+	assert.ErrorIs(t, err, domain.ErrURLNotFound)
+}
+
+func TestURLShortener_UpdateURLDuringLoad(t *testing.T) {
+	db := newFakeDB(&domain.Link{ID: 1, Code: "abc", URL: "https://example.com/first"})
+	cache := newFakeCache()
+	shortener := New(slogdiscard.NewDiscardLogger(), cache, db, &fakeGenerator{}, fakeHits{}, canonical.New(true), nil)
+
+	// the link is updated after the load has read it, but before the load has cached it
+	once := sync.Once{}
+	db.afterGet = func() {
+		once.Do(func() {
+			_, err := shortener.UpdateURL(context.Background(), "abc", "https://example.com/second")
+			require.NoError(t, err)
+		})
+	}
+
+	link, err := shortener.Proxy(context.Background(), "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/first", link.URL)
+
+	// the stale destination read by the load is not left in the cache
+	assert.NotContains(t, cache.links, "abc")
+
+	link, err = shortener.Proxy(context.Background(), "abc")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/second", link.URL)
+}
+
+func TestURLShortener_Delete(t *testing.T) {
+	db := newFakeDB(&domain.Link{ID: 1, Code: "abc", URL: "https://example.com/first"})
+	cache := newFakeCache()
+	shortener := New(slogdiscard.NewDiscardLogger(), cache, db, &fakeGenerator{}, fakeHits{}, canonical.New(true), nil)
+
+	_, err := shortener.Proxy(context.Background(), "abc")
+	require.NoError(t, err)
+	require.Contains(t, cache.links, "abc")
+
+	require.NoError(t, shortener.Delete(context.Background(), "abc"))
+	assert.NotContains(t, cache.links, "abc")
+	assert.Empty(t, db.links)
+
+	_, err = shortener.Proxy(context.Background(), "abc")
+	assert.ErrorIs(t, err, domain.ErrURLNotFound)
+
+	err = shortener.Delete(context.Background(), "abc")
+	assert.ErrorIs(t, err, domain.ErrURLNotFound)
+}
+
+func TestURLShortener_PurgeExpired(t *testing.T) {
+	now := time.Now()
+	expired := now.Add(-time.Hour)
+
+	links := []*domain.Link{{ID: 1, Code: "live", URL: "https://example.com/live"}}
+	for i := 0; i < 2*purgeBatchSize+1; i++ {
+		links = append(links, &domain.Link{ID: i + 2, Code: fmt.Sprintf("old%d", i), URL: "https://example.com/old", ExpiresOn: &expired})
+	}
+
+	db := newFakeDB(links...)
+	cache := newFakeCache()
+	shortener := New(slogdiscard.NewDiscardLogger(), cache, db, &fakeGenerator{}, fakeHits{}, canonical.New(true), nil)
+	require.NoError(t, cache.StoreLink(context.Background(), links[1]))
+
+	purged, err := shortener.PurgeExpired(context.Background(), now)
+	require.NoError(t, err)
+
+	// links are deleted in batches until a batch is not full
+	assert.Equal(t, 2*purgeBatchSize+1, purged)
+	assert.Equal(t, 3, db.deletes)
+	assert.Len(t, db.links, 1)
+	assert.NotContains(t, cache.links, links[1].Code)
+}
+
+func TestURLShortener_ProxyExpired(t *testing.T) {
+	expiresOn := time.Now().Add(-time.Minute)
+	db := newFakeDB(&domain.Link{ID: 1, Code: "old", URL: "https://example.com/first", ExpiresOn: &expiresOn})
+	shortener := newTestShortener(db, &fakeGenerator{})
+
+	_, err := shortener.Proxy(context.Background(), "old")
+
+	assert.ErrorIs(t, err, domain.ErrURLGone)
+}
+
+// missingCache misses every lookup
+type missingCache struct {
+	*fakeCache
+}
+
+func (c *missingCache) QueryLink(context.Context, string) (*domain.Link, error) {
+	return nil, errors.New("key does not exists")
+}
+
+// waitingContext reports to waiting once Proxy waits for the result of the DB query,
+// which it does after joining the query
+type waitingContext struct {
+	context.Context
+	once    sync.Once
+	waiting *sync.WaitGroup
+}
+
+func (c *waitingContext) Done() <-chan struct{} {
+	c.once.Do(c.waiting.Done)
+	return c.Context.Done()
+}
+
+func TestURLShortener_ProxyCoalescesMisses(t *testing.T) {
+	const requests = 50
+
+	db := newFakeDB(&domain.Link{ID: 1, Code: "viral", URL: "https://example.com/viral"})
+	db.release = make(chan struct{})
+
+	cache := &missingCache{fakeCache: newFakeCache()}
+	shortener := New(slogdiscard.NewDiscardLogger(), cache, db, &fakeGenerator{}, fakeHits{}, canonical.New(true), nil)
+
+	waiting := &sync.WaitGroup{}
+	waiting.Add(requests)
+
+	links := make(chan *domain.Link, requests)
+	wg := sync.WaitGroup{}
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx := &waitingContext{Context: context.Background(), waiting: waiting}
+			link, err := shortener.Proxy(ctx, "viral")
+			assert.NoError(t, err)
+			links <- link
+		}()
+	}
+
+	// the DB query is blocked until all requests have joined it
+	waiting.Wait()
+	close(db.release)
+	wg.Wait()
+	close(links)
+
+	assert.Equal(t, 1, db.queries)
+	assert.Equal(t, 1, cache.stores)
+
+	seen := make(map[*domain.Link]struct{})
+	for link := range links {
+		assert.Equal(t, "https://example.com/viral", link.URL)
+		seen[link] = struct{}{}
+	}
+
+	assert.Len(t, seen, requests)
+}
+
+func TestURLShortener_ProxyNotFound(t *testing.T) {
+	shortener := newTestShortener(newFakeDB(), &fakeGenerator{})
+
+	_, err := shortener.Proxy(context.Background(), "missing")
+
+	assert.ErrorIs(t, err, domain.ErrURLNotFound)
+}
+
+func TestURLShortener_ProxyCachesMissing(t *testing.T) {
+	db := newFakeDB()
+	shortener := newTestShortener(db, &fakeGenerator{codes: []string{"missing"}})
+
+	for i := 0; i < 3; i++ {
+		_, err := shortener.Proxy(context.Background(), "missing")
+		assert.ErrorIs(t, err, domain.ErrURLNotFound)
+	}
+
+	assert.Equal(t, 1, db.queries)
+
+	// the link created under the missing code drops the cached miss
+	_, err := shortener.Create(context.Background(), &domain.Link{URL: "https://example.com"})
+	require.NoError(t, err)
+
+	link, err := shortener.Proxy(context.Background(), "missing")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", link.URL)
+}
+
+func TestURLShortener_ProxyFilter(t *testing.T) {
+	db := newFakeDB(&domain.Link{ID: 1, Code: "known", URL: "https://example.com/known"})
+	shortener := New(slogdiscard.NewDiscardLogger(), newFakeCache(), db, &fakeGenerator{codes: []string{"new"}}, fakeHits{}, canonical.New(true), bloom.New(100, 0.01))
+
+	require.NoError(t, shortener.BuildFilter(context.Background()))
+
+	_, err := shortener.Proxy(context.Background(), "unknown")
+	assert.ErrorIs(t, err, domain.ErrURLNotFound)
+	assert.Equal(t, 0, db.queries)
+
+	link, err := shortener.Proxy(context.Background(), "known")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/known", link.URL)
+
+	// created links pass the filter right away
+	_, err = shortener.Create(context.Background(), &domain.Link{URL: "https://example.com/new"})
+	require.NoError(t, err)
+
+	_, err = shortener.Proxy(context.Background(), "new")
+	assert.NoError(t, err)
+}
+
+func TestURLShortener_CreateCachesLink(t *testing.T) {
+	cache := newFakeCache()
+	shortener := New(slogdiscard.NewDiscardLogger(), cache, newFakeDB(), &fakeGenerator{codes: []string{"new"}}, fakeHits{}, canonical.New(true), nil)
+
+	_, err := shortener.Create(context.Background(), &domain.Link{URL: "https://example.com/new"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://example.com/new", cache.links["new"].URL)
+	assert.Equal(t, []string{"new"}, cache.created)
+}
+
+func TestURLShortener_Warmup(t *testing.T) {
+	links := make([]*domain.Link, 0, 250)
+	for i := 1; i <= 250; i++ {
+		links = append(links, &domain.Link{ID: i, Code: fmt.Sprintf("code%d", i), URL: "https://example.com"})
+	}
+
+	cache := newFakeCache()
+	shortener := New(slogdiscard.NewDiscardLogger(), cache, newFakeDB(links...), &fakeGenerator{}, fakeHits{}, canonical.New(true), nil)
+
+	var waited []int
+	warmed, err := shortener.Warmup(context.Background(), domain.OrderByRecent, 220, func(_ context.Context, n int) error {
+		waited = append(waited, n)
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 220, warmed)
+	assert.Equal(t, []int{100, 100, 20}, waited)
+	assert.Len(t, cache.links, 220)
+	assert.Contains(t, cache.links, "code250")
+	assert.NotContains(t, cache.links, "code30")
+}
@@ -0,0 +1,51 @@
+package url_shortener
+
+import (
+	"context"
+	"golang.org/x/time/rate"
+	"log/slog"
+	"url-shortner/internal/domain"
+)
+
+const warmupBatchSize = 100
+
+// Warmer preloads the top links into the cache once at startup,
+// so that they are not served from the DB after the cache is flushed.
+// Links are read and stored at a limited rate, so that the DB is not overloaded.
+type Warmer struct {
+	logger    *slog.Logger
+	shortener *URLShortener
+	order     domain.LinkOrder
+	size      int
+	limiter   *rate.Limiter
+}
+
+// NewWarmer returns the warmer of size links per second in the given order.
+func NewWarmer(logger *slog.Logger, shortener *URLShortener, order domain.LinkOrder, size, perSecond int) *Warmer {
+	return &Warmer{
+		logger:    logger,
+		shortener: shortener,
+		order:     order,
+		size:      size,
+		limiter:   rate.NewLimiter(rate.Limit(perSecond), warmupBatchSize),
+	}
+}
+
+// Run preloads the links and returns, it stops early when the context is done.
+func (w *Warmer) Run(ctx context.Context) error {
+	warmed, err := w.shortener.Warmup(ctx, w.order, w.size, func(ctx context.Context, n int) error {
+		return w.limiter.WaitN(ctx, n)
+	})
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		w.logger.Error("failed to warm up cache", slog.String("error", err.Error()))
+	}
+
+	w.logger.Info("warmed up cache", slog.Int("count", warmed))
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package memory
+
+import (
+	"container/list"
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+	"url-shortner/internal/domain"
+)
+
+// Remote is the shared cache behind the in-process one.
+// Invalidated and created codes published by one replica are delivered to all of them,
+// ListenInvalidations passes nil codes to handle once subscribed.
+type Remote interface {
+	QueryLink(ctx context.Context, code string) (*domain.Link, error)
+	StoreLink(ctx context.Context, link *domain.Link) error
+	StoreMissing(ctx context.Context, code string) error
+	DeleteLinks(ctx context.Context, codes ...string) error
+	PublishInvalidation(ctx context.Context, codes ...string) error
+	PublishCreated(ctx context.Context, codes ...string) error
+	ListenInvalidations(ctx context.Context, handle func(codes []string, created bool)) error
+}
+
+type entry struct {
+	link     domain.Link
+	deadline time.Time
+}
+
+// LRU keeps the most recently used links in memory in front of the remote cache.
+// Entries live no longer than ttl and the expiration of their links.
+type LRU struct {
+	logger *slog.Logger
+	remote Remote
+	size   int
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+
+	hits   atomic.Int64
+	misses atomic.Int64
+
+	listeners []func(codes []string)
+}
+
+func NewLRU(logger *slog.Logger, remote Remote, size int, ttl time.Duration) *LRU {
+	return &LRU{
+		logger:  logger,
+		remote:  remote,
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *LRU) QueryLink(ctx context.Context, code string) (*domain.Link, error) {
+	link, ok := c.get(code, time.Now())
+	if ok {
+		c.hits.Add(1)
+		return link, nil
+	}
+
+	c.misses.Add(1)
+
+	link, err := c.remote.QueryLink(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	c.put(link, time.Now())
+
+	return link, nil
+}
+
+func (c *LRU) StoreLink(ctx context.Context, link *domain.Link) error {
+	c.put(link, time.Now())
+
+	return c.remote.StoreLink(ctx, link)
+}
+
+// StoreMissing is passed to the remote cache, missing codes are not kept in memory,
+// so that links created under them are visible on other replicas without delay
+func (c *LRU) StoreMissing(ctx context.Context, code string) error {
+	return c.remote.StoreMissing(ctx, code)
+}
+
+func (c *LRU) DeleteLinks(ctx context.Context, codes ...string) error {
+	c.remove(codes...)
+
+	err := c.remote.DeleteLinks(ctx, codes...)
+	if err != nil {
+		return err
+	}
+
+	return c.remote.PublishInvalidation(ctx, codes...)
+}
+
+// Stats returns the number of lookups served from memory and passed to the remote cache
+func (c *LRU) Stats() map[string]int64 {
+	c.mu.Lock()
+	size := c.order.Len()
+	c.mu.Unlock()
+
+	return map[string]int64{
+		"hits":   c.hits.Load(),
+		"misses": c.misses.Load(),
+		"size":   int64(size),
+	}
+}
+
+// PublishCreated tells other replicas codes of new links, which are not dropped from caches
+func (c *LRU) PublishCreated(ctx context.Context, codes ...string) error {
+	return c.remote.PublishCreated(ctx, codes...)
+}
+
+// OnInvalidation registers the listener of codes invalidated or created by any replica.
+// The listener gets nil codes once subscribed, since invalidations published before may have been missed.
+// It should be called before Run.
+func (c *LRU) OnInvalidation(listener func(codes []string)) {
+	c.listeners = append(c.listeners, listener)
+}
+
+// Run drops links invalidated by other replicas until ctx is done.
+func (c *LRU) Run(ctx context.Context) error {
+	subscribed := false
+
+	for {
+		err := c.remote.ListenInvalidations(ctx, func(codes []string, created bool) {
+			// invalidations may have been missed while resubscribing, so the cache is started over
+			if codes == nil {
+				if subscribed {
+					c.clear()
+				}
+
+				subscribed = true
+				c.notify(nil)
+
+				return
+			}
+
+			if !created {
+				c.remove(codes...)
+			}
+
+			c.notify(codes)
+		})
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		c.logger.Error("failed to listen cache invalidations", slog.String("error", err.Error()))
+		c.clear()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (c *LRU) notify(codes []string) {
+	for _, listener := range c.listeners {
+		listener(codes)
+	}
+}
+
+func (c *LRU) get(code string, now time.Time) (*domain.Link, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[code]
+	if !ok {
+		return nil, false
+	}
+
+	e := element.Value.(*entry)
+	if !now.Before(e.deadline) {
+		c.order.Remove(element)
+		delete(c.entries, code)
+
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	link := e.link
+
+	return &link, true
+}
+
+func (c *LRU) put(link *domain.Link, now time.Time) {
+	deadline := now.Add(c.ttl)
+	if link.ExpiresOn != nil && link.ExpiresOn.Before(deadline) {
+		deadline = *link.ExpiresOn
+	}
+
+	if !now.Before(deadline) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[link.Code]; ok {
+		element.Value = &entry{link: *link, deadline: deadline}
+		c.order.MoveToFront(element)
+
+		return
+	}
+
+	c.entries[link.Code] = c.order.PushFront(&entry{link: *link, deadline: deadline})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).link.Code)
+	}
+}
+
+func (c *LRU) remove(codes ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, code := range codes {
+		if element, ok := c.entries[code]; ok {
+			c.order.Remove(element)
+			delete(c.entries, code)
+		}
+	}
+}
+
+func (c *LRU) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.entries = make(map[string]*list.Element, c.size)
+}
@@ -0,0 +1,230 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+	"url-shortner/internal/domain"
+	"url-shortner/pkg/logger/slogdiscard"
+)
+
+type fakeRemote struct {
+	mu          sync.Mutex
+	links       map[string]*domain.Link
+	queries     int
+	invalidated []string
+	listeners   []func(codes []string, created bool)
+}
+
+func newFakeRemote() *fakeRemote {
+	return &fakeRemote{links: make(map[string]*domain.Link)}
+}
+
+func (f *fakeRemote) QueryLink(_ context.Context, code string) (*domain.Link, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.queries++
+
+	link, ok := f.links[code]
+	if !ok {
+		return nil, errors.New("key does not exists")
+	}
+
+	return link, nil
+}
+
+func (f *fakeRemote) StoreLink(_ context.Context, link *domain.Link) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.links[link.Code] = link
+
+	return nil
+}
+
+func (f *fakeRemote) StoreMissing(context.Context, string) error {
+	return nil
+}
+
+func (f *fakeRemote) DeleteLinks(_ context.Context, codes ...string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, code := range codes {
+		delete(f.links, code)
+	}
+
+	return nil
+}
+
+func (f *fakeRemote) PublishInvalidation(_ context.Context, codes ...string) error {
+	f.mu.Lock()
+	f.invalidated = append(f.invalidated, codes...)
+	f.mu.Unlock()
+
+	f.publish(codes, false)
+
+	return nil
+}
+
+func (f *fakeRemote) PublishCreated(_ context.Context, codes ...string) error {
+	f.publish(codes, true)
+
+	return nil
+}
+
+func (f *fakeRemote) publish(codes []string, created bool) {
+	f.mu.Lock()
+	listeners := f.listeners
+	f.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(codes, created)
+	}
+}
+
+func (f *fakeRemote) ListenInvalidations(ctx context.Context, handle func(codes []string, created bool)) error {
+	f.mu.Lock()
+	f.listeners = append(f.listeners, handle)
+	f.mu.Unlock()
+
+	handle(nil, false)
+
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+func TestLRU_QueryLink(t *testing.T) {
+	remote := newFakeRemote()
+	remote.links["abc"] = &domain.Link{ID: 1, Code: "abc", URL: "https://example.com"}
+
+	cache := NewLRU(slogdiscard.NewDiscardLogger(), remote, 10, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		link, err := cache.QueryLink(context.Background(), "abc")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", link.URL)
+	}
+
+	_, err := cache.QueryLink(context.Background(), "missing")
+	assert.Error(t, err)
+
+	assert.Equal(t, 2, remote.queries)
+	assert.Equal(t, map[string]int64{"hits": 2, "misses": 2, "size": 1}, cache.Stats())
+}
+
+func TestLRU_Eviction(t *testing.T) {
+	cache := NewLRU(slogdiscard.NewDiscardLogger(), newFakeRemote(), 2, time.Minute)
+	now := time.Now()
+
+	cache.put(&domain.Link{Code: "a"}, now)
+	cache.put(&domain.Link{Code: "b"}, now)
+
+	// "a" becomes the most recently used, so "b" is evicted
+	_, ok := cache.get("a", now)
+	assert.True(t, ok)
+
+	cache.put(&domain.Link{Code: "c"}, now)
+
+	_, ok = cache.get("b", now)
+	assert.False(t, ok)
+
+	_, ok = cache.get("a", now)
+	assert.True(t, ok)
+}
+
+func TestLRU_Expiration(t *testing.T) {
+	cache := NewLRU(slogdiscard.NewDiscardLogger(), newFakeRemote(), 10, time.Minute)
+	now := time.Now()
+	expiresOn := now.Add(time.Second)
+
+	cache.put(&domain.Link{Code: "a"}, now)
+	cache.put(&domain.Link{Code: "b", ExpiresOn: &expiresOn}, now)
+
+	_, ok := cache.get("b", now.Add(2*time.Second))
+	assert.False(t, ok)
+
+	_, ok = cache.get("a", now.Add(2*time.Second))
+	assert.True(t, ok)
+
+	_, ok = cache.get("a", now.Add(time.Minute))
+	assert.False(t, ok)
+}
+
+func TestLRU_Invalidation(t *testing.T) {
+	remote := newFakeRemote()
+	first := NewLRU(slogdiscard.NewDiscardLogger(), remote, 10, time.Minute)
+	second := NewLRU(slogdiscard.NewDiscardLogger(), remote, 10, time.Minute)
+
+	// the listener is also called from Run once subscribed
+	var mu sync.Mutex
+	var received []string
+	second.OnInvalidation(func(codes []string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		received = append(received, codes...)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go first.Run(ctx)
+	go second.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		remote.mu.Lock()
+		defer remote.mu.Unlock()
+
+		return len(remote.listeners) == 2
+	}, time.Second, time.Millisecond)
+
+	link := &domain.Link{ID: 1, Code: "abc", URL: "https://example.com"}
+	require.NoError(t, first.StoreLink(ctx, link))
+	second.put(link, time.Now())
+
+	require.NoError(t, first.DeleteLinks(ctx, "abc"))
+
+	_, ok := second.get("abc", time.Now())
+	assert.False(t, ok)
+	assert.Equal(t, []string{"abc"}, remote.invalidated)
+
+	// created codes are passed to listeners, while cached links are kept
+	second.put(link, time.Now())
+	require.NoError(t, first.PublishCreated(ctx, "abc"))
+
+	_, ok = second.get("abc", time.Now())
+	assert.True(t, ok)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"abc", "abc"}, received)
+}
+
+func TestLRU_NotifiesOnSubscribe(t *testing.T) {
+	cache := NewLRU(slogdiscard.NewDiscardLogger(), newFakeRemote(), 10, time.Minute)
+
+	// listeners start over once subscribed, since codes published before were not delivered
+	subscribed := make(chan []string, 1)
+	cache.OnInvalidation(func(codes []string) {
+		subscribed <- codes
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go cache.Run(ctx)
+
+	select {
+	case codes := <-subscribed:
+		assert.Nil(t, codes)
+	case <-time.After(time.Second):
+		t.Fatal("listener is not notified once subscribed")
+	}
+}
@@ -0,0 +1,139 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"time"
+	"url-shortner/internal/domain"
+)
+
+// topReferrersLimit is the number of referrers in click report
+const topReferrersLimit = 10
+
+// InsertClicks writes the batch of clicks using COPY protocol.
+func (pg *Postgres) InsertClicks(ctx context.Context, clicks []*domain.Click) error {
+	columns := []string{"link_id", "clicked_at", "referrer", "browser", "os", "device", "bot"}
+
+	_, err := pg.pool.CopyFrom(ctx, pgx.Identifier{"clicks"}, columns, pgx.CopyFromSlice(len(clicks), func(i int) ([]any, error) {
+		c := clicks[i]
+		return []any{c.LinkID, c.ClickedAt, c.Referrer, c.Browser, c.OS, c.Device, c.Bot}, nil
+	}))
+	if err != nil {
+		return fmt.Errorf("storage.pg.InsertClicks: %w", err)
+	}
+
+	return nil
+}
+
+// EnsureClickPartitions creates monthly partitions of clicks table
+// for the month of the given time and the next one.
+func (pg *Postgres) EnsureClickPartitions(ctx context.Context, now time.Time) error {
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	for _, from := range []time.Time{month, month.AddDate(0, 1, 0)} {
+		err := pg.createClickPartition(ctx, from, from.AddDate(0, 1, 0))
+		if err != nil {
+			return fmt.Errorf("storage.pg.EnsureClickPartitions: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// createClickPartition creates the partition of clicks in [from, to) unless it exists.
+// A partition can't be added while the default one holds rows of its range, which happens
+// when clicks were written before the partition was created, so such rows are moved into it.
+func (pg *Postgres) createClickPartition(ctx context.Context, from, to time.Time) error {
+	name := fmt.Sprintf("clicks_y%04dm%02d", from.Year(), from.Month())
+
+	var exists bool
+	err := pg.pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", name).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+
+	tx, err := pg.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+
+	// inserts of clicks wait until the rows are moved, so that none of them is left in the default partition
+	_, err = tx.Exec(ctx, "LOCK TABLE clicks IN SHARE ROW EXCLUSIVE MODE")
+	if err != nil {
+		return err
+	}
+
+	table := pgx.Identifier{name}.Sanitize()
+
+	_, err = tx.Exec(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (LIKE clicks INCLUDING DEFAULTS INCLUDING CONSTRAINTS)", table))
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf(`WITH moved AS (
+			DELETE FROM clicks_default WHERE clicked_at >= $1 AND clicked_at < $2 RETURNING *
+		)
+		INSERT INTO %s SELECT * FROM moved`, table), from, to)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, fmt.Sprintf("ALTER TABLE clicks ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')",
+		table, from.Format(time.RFC3339), to.Format(time.RFC3339)))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ClickReport aggregates human clicks of the link into time buckets and top referrers.
+func (pg *Postgres) ClickReport(ctx context.Context, filter *domain.ClickFilter) (*domain.ClickReport, error) {
+	report := domain.ClickReport{
+		Buckets:      []domain.ClickBucket{},
+		TopReferrers: []domain.ReferrerClicks{},
+	}
+
+	rows, err := pg.pool.Query(ctx, `SELECT date_trunc($2, clicked_at, 'UTC') AS bucket, count(*) FROM clicks
+		WHERE link_id = $1 AND clicked_at >= $3 AND clicked_at < $4 AND NOT bot
+		GROUP BY bucket ORDER BY bucket`, filter.LinkID, filter.Interval, filter.From, filter.To)
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.ClickReport: %w", err)
+	}
+
+	report.Buckets, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (domain.ClickBucket, error) {
+		var bucket domain.ClickBucket
+		err := row.Scan(&bucket.Time, &bucket.Clicks)
+		return bucket, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.ClickReport: %w", err)
+	}
+
+	rows, err = pg.pool.Query(ctx, `SELECT referrer, count(*) AS clicks FROM clicks
+		WHERE link_id = $1 AND clicked_at >= $2 AND clicked_at < $3 AND NOT bot AND referrer <> ''
+		GROUP BY referrer ORDER BY clicks DESC LIMIT $4`, filter.LinkID, filter.From, filter.To, topReferrersLimit)
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.ClickReport: %w", err)
+	}
+
+	report.TopReferrers, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (domain.ReferrerClicks, error) {
+		var referrer domain.ReferrerClicks
+		err := row.Scan(&referrer.Referrer, &referrer.Clicks)
+		return referrer, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.ClickReport: %w", err)
+	}
+
+	err = pg.pool.QueryRow(ctx, `SELECT count(*) FROM clicks
+		WHERE link_id = $1 AND clicked_at >= $2 AND clicked_at < $3 AND bot`, filter.LinkID, filter.From, filter.To).Scan(&report.BotClicks)
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.ClickReport: %w", err)
+	}
+
+	return &report, nil
+}
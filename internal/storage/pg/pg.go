@@ -5,10 +5,25 @@ import (
 	"errors"
 	"fmt"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"strings"
+	"time"
 	"url-shortner/internal/domain"
 )
 
+const (
+	// uniqueViolation is the postgres error code for a unique constraint violation
+	uniqueViolation = "23505"
+
+	linkColumns = "id, COALESCE(code, ''), url, canonical_url, COALESCE(alias, ''), expires_on, COALESCE(redirect_type, 0), clicks"
+
+	// urlHash is the hash of the canonical url, links without alias, expiration and redirect type are unique by it
+	urlHash = "sha256(convert_to(%s::text, 'UTF8'))"
+)
+
+var likeReplacer = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 type Postgres struct {
 	pool *pgxpool.Pool
 }
@@ -38,23 +53,423 @@ func (pg *Postgres) CloseConnection() {
 	pg.pool.Close()
 }
 
-func (pg *Postgres) GetByID(ctx context.Context, id int) (*domain.Link, error) {
-	var link domain.Link
-	err := pg.pool.QueryRow(ctx, "SELECT id, url FROM links WHERE id = $1", id).Scan(&link.ID, &link.URL)
+func (pg *Postgres) GetByCode(ctx context.Context, code string) (*domain.Link, error) {
+	return scanLink(pg.pool.QueryRow(ctx, "SELECT "+linkColumns+" FROM links WHERE code = $1", code))
+}
+
+// GetByURL looks up a link without alias and expiration by the canonical url, since other links are never deduplicated.
+func (pg *Postgres) GetByURL(ctx context.Context, canonicalURL string) (*domain.Link, error) {
+	return scanLink(pg.pool.QueryRow(ctx, "SELECT "+linkColumns+" FROM links WHERE url_hash = "+fmt.Sprintf(urlHash, "$1")+
+		" AND alias IS NULL AND expires_on IS NULL", canonicalURL))
+}
+
+// NextID reserves an id for a new link, so that its code can be derived from the id before insert.
+func (pg *Postgres) NextID(ctx context.Context) (int, error) {
+	var id int
+	err := pg.pool.QueryRow(ctx, "SELECT nextval(pg_get_serial_sequence('links', 'id'))").Scan(&id)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, domain.ErrURLNotFound
+		return 0, fmt.Errorf("storage.pg.NextID: %w", err)
+	}
+
+	return id, nil
+}
+
+// NextIDs reserves ids for n new links in a single query.
+func (pg *Postgres) NextIDs(ctx context.Context, n int) ([]int, error) {
+	rows, err := pg.pool.Query(ctx, "SELECT nextval(pg_get_serial_sequence('links', 'id')) FROM generate_series(1, $1)", n)
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.NextIDs: %w", err)
+	}
+
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.NextIDs: %w", err)
+	}
+
+	return ids, nil
+}
+
+// TakenCodes returns which of the given codes are already used by links.
+func (pg *Postgres) TakenCodes(ctx context.Context, codes []string) ([]string, error) {
+	rows, err := pg.pool.Query(ctx, "SELECT code FROM links WHERE code = ANY($1::text[])", codes)
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.TakenCodes: %w", err)
+	}
+
+	taken, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.TakenCodes: %w", err)
+	}
+
+	return taken, nil
+}
+
+// PersistURLs inserts the links with reserved ids and codes in a single multi-row insert, so either all or none are stored.
+// Like PersistURL, links which may be deduplicated are returned as the existing links for their urls.
+// The canonical urls of such links must be unique within the batch.
+// It returns the stored links in the order of the given ones, or domain.ErrCodeTaken if any code is already used.
+func (pg *Postgres) PersistURLs(ctx context.Context, links []*domain.Link) ([]*domain.Link, error) {
+	ids := make([]int, 0, len(links))
+	codes := make([]string, 0, len(links))
+	urls := make([]string, 0, len(links))
+	canonicalURLs := make([]string, 0, len(links))
+	aliases := make([]string, 0, len(links))
+	expiresOn := make([]*time.Time, 0, len(links))
+	redirectTypes := make([]int, 0, len(links))
+	for _, link := range links {
+		ids = append(ids, link.ID)
+		codes = append(codes, link.Code)
+		urls = append(urls, link.URL)
+		canonicalURLs = append(canonicalURLs, link.CanonicalURL)
+		aliases = append(aliases, link.Alias)
+		expiresOn = append(expiresOn, link.ExpiresOn)
+		redirectTypes = append(redirectTypes, link.RedirectType)
+	}
+
+	rows, err := pg.pool.Query(ctx, `INSERT INTO links (id, code, url, canonical_url, url_hash, alias, expires_on, redirect_type)
+		SELECT id, code, url, canonical_url, CASE WHEN redirect_type = 0 THEN `+fmt.Sprintf(urlHash, "canonical_url")+` END,
+			NULLIF(alias, ''), expires_on, NULLIF(redirect_type, 0)
+		FROM unnest($1::int[], $2::text[], $3::text[], $4::text[], $5::text[], $6::timestamptz[], $7::smallint[])
+			AS input(id, code, url, canonical_url, alias, expires_on, redirect_type)
+		ON CONFLICT (url_hash) WHERE alias IS NULL AND expires_on IS NULL DO UPDATE SET url_hash = EXCLUDED.url_hash
+		RETURNING `+linkColumns,
+		ids, codes, urls, canonicalURLs, aliases, expiresOn, redirectTypes)
+
+	var stored []*domain.Link
+	if err == nil {
+		stored, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (*domain.Link, error) {
+			return scanLink(row)
+		})
+	}
+
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return nil, domain.ErrCodeTaken
+		}
+
+		return nil, fmt.Errorf("storage.pg.PersistURLs: %w", err)
+	}
+
+	// rows are returned in no particular order, inserted links keep their codes,
+	// deduplicated ones are found by the canonical url among links which may be deduplicated,
+	// since links with aliases may have the same url
+	byCode := make(map[string]*domain.Link, len(stored))
+	byURL := make(map[string]*domain.Link, len(stored))
+	for _, link := range stored {
+		byCode[link.Code] = link
+		if link.Dedupable() {
+			byURL[link.CanonicalURL] = link
+		}
+	}
+
+	result := make([]*domain.Link, 0, len(links))
+	for _, link := range links {
+		storedLink, ok := byCode[link.Code]
+		if !ok && link.Dedupable() {
+			storedLink, ok = byURL[link.CanonicalURL]
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("storage.pg.PersistURLs: link %q is not returned", link.Code)
+		}
+
+		result = append(result, storedLink)
+	}
+
+	return result, nil
+}
+
+// PersistURL inserts the link with the reserved id and the generated code.
+// If a link without alias, expiration and redirect type already exists for the url, it is returned instead,
+// so that concurrent requests never create duplicates.
+// It returns domain.ErrCodeTaken if the code is already used by another link.
+func (pg *Postgres) PersistURL(ctx context.Context, link *domain.Link) (*domain.Link, error) {
+	// the no-op update makes the existing row returned on conflict
+	// links with own redirect type are left without hash, so that they never conflict
+	newLink, err := scanLink(pg.pool.QueryRow(ctx, `INSERT INTO links (id, code, url, canonical_url, url_hash, alias, expires_on, redirect_type)
+		VALUES($1, $2, $3, $4, CASE WHEN $7::smallint = 0 THEN `+fmt.Sprintf(urlHash, "$4")+` END, NULLIF($5, ''), $6, NULLIF($7::smallint, 0))
+		ON CONFLICT (url_hash) WHERE alias IS NULL AND expires_on IS NULL DO UPDATE SET url_hash = EXCLUDED.url_hash
+		RETURNING `+linkColumns,
+		link.ID, link.Code, link.URL, link.CanonicalURL, link.Alias, link.ExpiresOn, link.RedirectType))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return nil, domain.ErrCodeTaken
 		}
 
 		return nil, err
 	}
 
-	return &link, nil
+	return newLink, nil
+}
+
+// UpdateURL changes the destination of the link.
+// The link is no longer deduplicated to, since another link may already exist for the new url.
+func (pg *Postgres) UpdateURL(ctx context.Context, code string, url, canonicalURL string) (*domain.Link, error) {
+	return scanLink(pg.pool.QueryRow(ctx, "UPDATE links SET url = $2, canonical_url = $3, url_hash = NULL WHERE code = $1 RETURNING "+linkColumns,
+		code, url, canonicalURL))
+}
+
+func (pg *Postgres) Delete(ctx context.Context, code string) (*domain.Link, error) {
+	return scanLink(pg.pool.QueryRow(ctx, "DELETE FROM links WHERE code = $1 RETURNING "+linkColumns, code))
+}
+
+// ListWithoutCode returns links created before codes were stored, in id order starting after the given id.
+func (pg *Postgres) ListWithoutCode(ctx context.Context, afterID, limit int) ([]*domain.Link, error) {
+	rows, err := pg.pool.Query(ctx, "SELECT "+linkColumns+" FROM links WHERE code IS NULL AND id > $1 ORDER BY id LIMIT $2", afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.ListWithoutCode: %w", err)
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*domain.Link, error) {
+		return scanLink(row)
+	})
+}
+
+// ListCodes returns ids and codes of links in id order starting after the given id.
+func (pg *Postgres) ListCodes(ctx context.Context, afterID, limit int) ([]*domain.Link, error) {
+	rows, err := pg.pool.Query(ctx, "SELECT id, code FROM links WHERE code IS NOT NULL AND id > $1 ORDER BY id LIMIT $2", afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.ListCodes: %w", err)
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*domain.Link, error) {
+		var link domain.Link
+		err := row.Scan(&link.ID, &link.Code)
+
+		return &link, err
+	})
+}
+
+// SetCodes stores codes of the links which have none yet.
+// Codes already used by other links are skipped.
+// It returns the number of updated links.
+func (pg *Postgres) SetCodes(ctx context.Context, links []*domain.Link) (int64, error) {
+	ids := make([]int, 0, len(links))
+	codes := make([]string, 0, len(links))
+	for _, link := range links {
+		ids = append(ids, link.ID)
+		codes = append(codes, link.Code)
+	}
+
+	tag, err := pg.pool.Exec(ctx, `UPDATE links SET code = c.code
+		FROM (SELECT unnest($1::int[]) AS id, unnest($2::text[]) AS code) AS c
+		WHERE links.id = c.id AND links.code IS NULL
+		AND NOT EXISTS (SELECT 1 FROM links AS other WHERE other.code = c.code)`, ids, codes)
+	if err != nil {
+		return 0, fmt.Errorf("storage.pg.SetCodes: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
 }
 
-func (pg *Postgres) GetByURL(ctx context.Context, url string) (*domain.Link, error) {
+// IncrementClicks adds the given numbers of clicks to the links in a single query.
+func (pg *Postgres) IncrementClicks(ctx context.Context, clicks map[int]int64) error {
+	ids := make([]int, 0, len(clicks))
+	counts := make([]int64, 0, len(clicks))
+	for id, n := range clicks {
+		ids = append(ids, id)
+		counts = append(counts, n)
+	}
+
+	_, err := pg.pool.Exec(ctx, `UPDATE links SET clicks = links.clicks + c.n
+		FROM (SELECT unnest($1::int[]) AS id, unnest($2::bigint[]) AS n) AS c
+		WHERE links.id = c.id`, ids, counts)
+	if err != nil {
+		return fmt.Errorf("storage.pg.IncrementClicks: %w", err)
+	}
+
+	return nil
+}
+
+// List returns links matching the filter, newest first.
+func (pg *Postgres) List(ctx context.Context, filter *domain.LinkFilter) ([]*domain.Link, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.CodePrefix != "" {
+		where("code LIKE $%d::text || '%%'", escapeLike(filter.CodePrefix))
+	}
+
+	if filter.URL != "" {
+		where("url ILIKE '%%' || $%d::text || '%%'", escapeLike(filter.URL))
+	}
+
+	if filter.Host != "" {
+		where("host = $%d", filter.Host)
+	}
+
+	if filter.Keyword != "" {
+		where("alias ILIKE '%%' || $%d::text || '%%'", escapeLike(filter.Keyword))
+	}
+
+	query := "SELECT " + linkColumns + " FROM links"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(" ORDER BY id DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := pg.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*domain.Link, error) {
+		return scanLink(row)
+	})
+}
+
+// ListTop returns a page of links with codes, which are not expired, in the given order.
+// Pages start after the last link of the previous page, the first page starts with nil.
+func (pg *Postgres) ListTop(ctx context.Context, order domain.LinkOrder, after *domain.Link, limit int) ([]*domain.Link, error) {
+	args := []any{limit}
+	keyset := "TRUE"
+	orderBy := "id DESC"
+
+	if order == domain.OrderByClicks {
+		orderBy = "clicks DESC, id DESC"
+		if after != nil {
+			keyset = "(clicks, id) < ($2, $3)"
+			args = append(args, after.Clicks, after.ID)
+		}
+	} else if after != nil {
+		keyset = "id < $2"
+		args = append(args, after.ID)
+	}
+
+	rows, err := pg.pool.Query(ctx, "SELECT "+linkColumns+` FROM links
+		WHERE code IS NOT NULL AND (expires_on IS NULL OR expires_on > now()) AND `+keyset+`
+		ORDER BY `+orderBy+" LIMIT $1", args...)
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.ListTop: %w", err)
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*domain.Link, error) {
+		return scanLink(row)
+	})
+}
+
+// DeleteExpired removes up to limit links which expired before the given time, so that no statement locks many rows.
+// Links locked by sweepers of other replicas are skipped.
+// It returns the removed links, so that caches can be invalidated.
+func (pg *Postgres) DeleteExpired(ctx context.Context, before time.Time, limit int) ([]*domain.Link, error) {
+	rows, err := pg.pool.Query(ctx, `DELETE FROM links WHERE id IN (
+			SELECT id FROM links WHERE expires_on < $1 ORDER BY expires_on LIMIT $2 FOR UPDATE SKIP LOCKED
+		) RETURNING `+linkColumns, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.DeleteExpired: %w", err)
+	}
+
+	links, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*domain.Link, error) {
+		return scanLink(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.DeleteExpired: %w", err)
+	}
+
+	return links, nil
+}
+
+// ExportLinks passes all links in id order to fn, reading them by a server-side cursor in batches of the given size,
+// so that links are never held in memory at once. Links are read from a single snapshot.
+// It stops with the error returned by fn.
+func (pg *Postgres) ExportLinks(ctx context.Context, batchSize int, fn func(link *domain.Link) error) error {
+	tx, err := pg.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("storage.pg.ExportLinks: %w", err)
+	}
+
+	// the transaction is read-only, so it is never committed
+	defer func() { _ = tx.Rollback(context.WithoutCancel(ctx)) }()
+
+	_, err = tx.Exec(ctx, "DECLARE links_export NO SCROLL CURSOR FOR SELECT "+linkColumns+" FROM links ORDER BY id")
+	if err != nil {
+		return fmt.Errorf("storage.pg.ExportLinks: %w", err)
+	}
+
+	for {
+		rows, err := tx.Query(ctx, "FETCH FORWARD $1 FROM links_export", batchSize)
+		if err != nil {
+			return fmt.Errorf("storage.pg.ExportLinks: %w", err)
+		}
+
+		links, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*domain.Link, error) {
+			return scanLink(row)
+		})
+		if err != nil {
+			return fmt.Errorf("storage.pg.ExportLinks: %w", err)
+		}
+
+		for _, link := range links {
+			if err := fn(link); err != nil {
+				return err
+			}
+		}
+
+		if len(links) < batchSize {
+			return nil
+		}
+	}
+}
+
+// ImportURLs inserts the links with reserved ids and their own codes in a single multi-row insert.
+// Links conflicting with existing codes or aliases are skipped, the others are stored with their clicks.
+// Imported links are never deduplicated to, so that the links for the same url keep their codes.
+// It returns the inserted links in no particular order.
+func (pg *Postgres) ImportURLs(ctx context.Context, links []*domain.Link) ([]*domain.Link, error) {
+	ids := make([]int, 0, len(links))
+	codes := make([]string, 0, len(links))
+	urls := make([]string, 0, len(links))
+	canonicalURLs := make([]string, 0, len(links))
+	aliases := make([]string, 0, len(links))
+	expiresOn := make([]*time.Time, 0, len(links))
+	redirectTypes := make([]int, 0, len(links))
+	clicks := make([]int64, 0, len(links))
+	for _, link := range links {
+		ids = append(ids, link.ID)
+		codes = append(codes, link.Code)
+		urls = append(urls, link.URL)
+		canonicalURLs = append(canonicalURLs, link.CanonicalURL)
+		aliases = append(aliases, link.Alias)
+		expiresOn = append(expiresOn, link.ExpiresOn)
+		redirectTypes = append(redirectTypes, link.RedirectType)
+		clicks = append(clicks, link.Clicks)
+	}
+
+	rows, err := pg.pool.Query(ctx, `INSERT INTO links (id, code, url, canonical_url, alias, expires_on, redirect_type, clicks)
+		SELECT id, code, url, canonical_url, NULLIF(alias, ''), expires_on, NULLIF(redirect_type, 0), clicks
+		FROM unnest($1::int[], $2::text[], $3::text[], $4::text[], $5::text[], $6::timestamptz[], $7::smallint[], $8::bigint[])
+			AS input(id, code, url, canonical_url, alias, expires_on, redirect_type, clicks)
+		ON CONFLICT DO NOTHING
+		RETURNING `+linkColumns,
+		ids, codes, urls, canonicalURLs, aliases, expiresOn, redirectTypes, clicks)
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.ImportURLs: %w", err)
+	}
+
+	imported, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*domain.Link, error) {
+		return scanLink(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("storage.pg.ImportURLs: %w", err)
+	}
+
+	return imported, nil
+}
+
+func scanLink(row pgx.Row) (*domain.Link, error) {
 	var link domain.Link
-	err := pg.pool.QueryRow(ctx, "SELECT id, url FROM links WHERE url = $1", url).Scan(&link.ID, &link.URL)
+	err := row.Scan(&link.ID, &link.Code, &link.URL, &link.CanonicalURL, &link.Alias, &link.ExpiresOn, &link.RedirectType, &link.Clicks)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, domain.ErrURLNotFound
@@ -66,15 +481,7 @@ func (pg *Postgres) GetByURL(ctx context.Context, url string) (*domain.Link, err
 	return &link, nil
 }
 
-func (pg *Postgres) PersistURL(ctx context.Context, url string) (*domain.Link, error) {
-	var newID int
-	err := pg.pool.QueryRow(ctx, "INSERT INTO links (url) VALUES($1) returning id", url).Scan(&newID)
-	if err != nil {
-		return nil, err
-	}
-
-	return &domain.Link{
-		ID:  newID,
-		URL: url,
-	}, nil
+// escapeLike escapes wildcard characters of LIKE pattern
+func escapeLike(s string) string {
+	return likeReplacer.Replace(s)
 }
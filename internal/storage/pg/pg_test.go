@@ -0,0 +1,249 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"sync"
+	"testing"
+	"time"
+	"url-shortner/internal/domain"
+)
+
+// newTestPostgres connects to the migrated database from POSTGRES_TEST_URL, the test is skipped without it
+func newTestPostgres(t *testing.T) *Postgres {
+	url := os.Getenv("POSTGRES_TEST_URL")
+	if url == "" {
+		t.Skip("POSTGRES_TEST_URL is not set")
+	}
+
+	pg, err := New(url)
+	require.NoError(t, err)
+	t.Cleanup(pg.CloseConnection)
+
+	return pg
+}
+
+func TestPostgres_PersistURLConcurrently(t *testing.T) {
+	pg := newTestPostgres(t)
+	ctx := context.Background()
+
+	const requests = 20
+	url := fmt.Sprintf("https://example.com/concurrent/%d", time.Now().UnixNano())
+
+	ids := make(chan int, requests)
+	wg := sync.WaitGroup{}
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			id, err := pg.NextID(ctx)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			link, err := pg.PersistURL(ctx, &domain.Link{ID: id, Code: fmt.Sprintf("t%d", id), URL: url, CanonicalURL: url})
+			if assert.NoError(t, err) {
+				ids <- link.ID
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(ids)
+
+	first := <-ids
+	for id := range ids {
+		assert.Equal(t, first, id)
+	}
+
+	var count int
+	err := pg.pool.QueryRow(ctx, "SELECT count(*) FROM links WHERE url = $1", url).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	_, err = pg.pool.Exec(ctx, "DELETE FROM links WHERE url = $1", url)
+	require.NoError(t, err)
+}
+
+func TestPostgres_PersistURLs(t *testing.T) {
+	pg := newTestPostgres(t)
+	ctx := context.Background()
+
+	prefix := fmt.Sprintf("https://example.com/batch/%d/", time.Now().UnixNano())
+
+	ids, err := pg.NextIDs(ctx, 5)
+	require.NoError(t, err)
+	require.Len(t, ids, 5)
+
+	newLink := func(n int, path, alias string) *domain.Link {
+		return &domain.Link{ID: ids[n], Code: fmt.Sprintf("t%d", ids[n]), URL: prefix + path, CanonicalURL: prefix + path, Alias: alias}
+	}
+
+	existing, err := pg.PersistURL(ctx, newLink(0, "existing", ""))
+	require.NoError(t, err)
+
+	aliased := newLink(3, "aliased", fmt.Sprintf("b%d", ids[3]))
+	aliased.Code = aliased.Alias
+
+	// the alias for the existing url is inserted, while the link without alias is deduplicated
+	aliasedExisting := newLink(4, "existing", fmt.Sprintf("l%d", ids[4]))
+	aliasedExisting.Code = aliasedExisting.Alias
+
+	links, err := pg.PersistURLs(ctx, []*domain.Link{newLink(1, "new", ""), aliasedExisting, newLink(2, "existing", ""), aliased})
+	require.NoError(t, err)
+	require.Len(t, links, 4)
+
+	assert.Equal(t, ids[1], links[0].ID)
+	assert.Equal(t, ids[4], links[1].ID)
+	assert.Equal(t, existing.ID, links[2].ID)
+	assert.Equal(t, existing.Code, links[2].Code)
+	assert.Equal(t, aliased.Alias, links[3].Code)
+
+	taken, err := pg.TakenCodes(ctx, []string{aliased.Code, "free-code"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{aliased.Code}, taken)
+
+	// a taken code fails the whole batch
+	_, err = pg.PersistURLs(ctx, []*domain.Link{newLink(1, "other", ""), aliased})
+	assert.ErrorIs(t, err, domain.ErrCodeTaken)
+
+	_, err = pg.pool.Exec(ctx, "DELETE FROM links WHERE url LIKE $1", prefix+"%")
+	require.NoError(t, err)
+}
+
+func TestPostgres_ImportAndExport(t *testing.T) {
+	pg := newTestPostgres(t)
+	ctx := context.Background()
+
+	prefix := fmt.Sprintf("https://example.com/import/%d/", time.Now().UnixNano())
+
+	ids, err := pg.NextIDs(ctx, 3)
+	require.NoError(t, err)
+
+	code := fmt.Sprintf("i%d", ids[0])
+	links := []*domain.Link{
+		{ID: ids[0], Code: code, URL: prefix + "first", CanonicalURL: prefix + "first", Clicks: 10},
+		{ID: ids[1], Code: code, URL: prefix + "second", CanonicalURL: prefix + "second"},
+		{ID: ids[2], Code: fmt.Sprintf("i%d", ids[2]), URL: prefix + "first", CanonicalURL: prefix + "first"},
+	}
+
+	// the duplicated code is skipped, the link for the same url keeps its own code
+	imported, err := pg.ImportURLs(ctx, links)
+	require.NoError(t, err)
+	assert.Len(t, imported, 2)
+
+	exported := make(map[string]*domain.Link)
+	err = pg.ExportLinks(ctx, 1, func(link *domain.Link) error {
+		exported[link.Code] = link
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Contains(t, exported, code)
+	assert.Equal(t, int64(10), exported[code].Clicks)
+	assert.Contains(t, exported, links[2].Code)
+
+	_, err = pg.pool.Exec(ctx, "DELETE FROM links WHERE url LIKE $1", prefix+"%")
+	require.NoError(t, err)
+}
+
+func TestPostgres_DeleteExpiredInBatches(t *testing.T) {
+	pg := newTestPostgres(t)
+	ctx := context.Background()
+
+	prefix := fmt.Sprintf("https://example.com/expired/%d/", time.Now().UnixNano())
+
+	ids, err := pg.NextIDs(ctx, 3)
+	require.NoError(t, err)
+
+	// links expired long before any other link of the database
+	expiresOn := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	links := make([]*domain.Link, 0, len(ids))
+	for i, id := range ids {
+		url := fmt.Sprintf("%s%d", prefix, i)
+		links = append(links, &domain.Link{ID: id, Code: fmt.Sprintf("exp%d", id), URL: url, CanonicalURL: url, ExpiresOn: &expiresOn})
+	}
+
+	_, err = pg.ImportURLs(ctx, links)
+	require.NoError(t, err)
+
+	before := expiresOn.Add(time.Hour)
+	var deleted []int
+	for _, size := range []int{2, 1, 0} {
+		batch, err := pg.DeleteExpired(ctx, before, 2)
+		require.NoError(t, err)
+		require.Len(t, batch, size)
+
+		for _, link := range batch {
+			deleted = append(deleted, link.ID)
+		}
+	}
+
+	assert.ElementsMatch(t, ids, deleted)
+}
+
+func TestPostgres_ListTopPages(t *testing.T) {
+	pg := newTestPostgres(t)
+	ctx := context.Background()
+
+	prefix := fmt.Sprintf("https://example.com/top/%d/", time.Now().UnixNano())
+
+	ids, err := pg.NextIDs(ctx, 3)
+	require.NoError(t, err)
+
+	// clicks are above any other link, the tie is broken by id
+	const clicks = int64(1) << 60
+	links := make([]*domain.Link, 0, len(ids))
+	for i, id := range ids {
+		url := fmt.Sprintf("%s%d", prefix, i)
+		links = append(links, &domain.Link{ID: id, Code: fmt.Sprintf("top%d", id), URL: url, CanonicalURL: url, Clicks: clicks - int64(i/2)})
+	}
+
+	_, err = pg.ImportURLs(ctx, links)
+	require.NoError(t, err)
+
+	var listed []int
+	var after *domain.Link
+	for range ids {
+		page, err := pg.ListTop(ctx, domain.OrderByClicks, after, 1)
+		require.NoError(t, err)
+		require.Len(t, page, 1)
+
+		listed = append(listed, page[0].ID)
+		after = page[0]
+	}
+
+	assert.Equal(t, []int{ids[1], ids[0], ids[2]}, listed)
+
+	_, err = pg.pool.Exec(ctx, "DELETE FROM links WHERE url LIKE $1", prefix+"%")
+	require.NoError(t, err)
+}
+
+func TestPostgres_EnsureClickPartitionsMovesDefaultRows(t *testing.T) {
+	pg := newTestPostgres(t)
+	ctx := context.Background()
+
+	// a far month, so that the partitions of the current one are not touched
+	month := time.Date(2090, time.January, 1, 0, 0, 0, 0, time.UTC)
+	t.Cleanup(func() {
+		_, _ = pg.pool.Exec(ctx, "DROP TABLE IF EXISTS clicks_y2090m01, clicks_y2090m02")
+	})
+
+	// the clicks are written before the partition exists, so they land in the default one
+	err := pg.InsertClicks(ctx, []*domain.Click{{LinkID: 1, ClickedAt: month.Add(time.Hour), Browser: "Firefox", OS: "Linux", Device: "desktop"}})
+	require.NoError(t, err)
+
+	require.NoError(t, pg.EnsureClickPartitions(ctx, month))
+	require.NoError(t, pg.EnsureClickPartitions(ctx, month))
+
+	var partitioned, left int
+	require.NoError(t, pg.pool.QueryRow(ctx, "SELECT count(*) FROM clicks_y2090m01").Scan(&partitioned))
+	require.NoError(t, pg.pool.QueryRow(ctx, "SELECT count(*) FROM clicks_default WHERE clicked_at >= $1", month).Scan(&left))
+
+	assert.Equal(t, 1, partitioned)
+	assert.Equal(t, 0, left)
+}
@@ -0,0 +1,237 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+	"url-shortner/internal/config"
+	"url-shortner/internal/domain"
+)
+
+// Breaker is the circuit breaker in front of Redis.
+// After a number of failed calls in a row it opens and fails all calls at once with domain.ErrCacheUnavailable,
+// so that requests are served by Postgres without waiting for Redis. Run closes it again once Redis answers pings.
+type Breaker struct {
+	redis         *Redis
+	logger        *slog.Logger
+	timeout       time.Duration
+	threshold     int
+	probeInterval time.Duration
+
+	open atomic.Bool
+
+	mu       sync.Mutex
+	failures int
+	// recovered is closed, when the breaker is closed again
+	recovered chan struct{}
+	// pending are codes which failed to be dropped, they are dropped on recovery
+	pending map[string]struct{}
+}
+
+// NewBreaker returns the breaker, which starts open if Redis didn't answer on start.
+func NewBreaker(redis *Redis, logger *slog.Logger, config *config.RedisConfig) *Breaker {
+	breaker := &Breaker{
+		redis:         redis,
+		logger:        logger,
+		timeout:       config.Timeout,
+		threshold:     config.FailureThreshold,
+		probeInterval: config.ProbeInterval,
+		recovered:     make(chan struct{}),
+		pending:       make(map[string]struct{}),
+	}
+
+	if !redis.Available() {
+		breaker.open.Store(true)
+	}
+
+	return breaker
+}
+
+// Healthy reports whether calls are passed to Redis
+func (b *Breaker) Healthy() bool {
+	return !b.open.Load()
+}
+
+func (b *Breaker) QueryLink(ctx context.Context, code string) (*domain.Link, error) {
+	var link *domain.Link
+
+	err := b.call(ctx, func(ctx context.Context) error {
+		var err error
+		link, err = b.redis.QueryLink(ctx, code)
+
+		return err
+	})
+
+	return link, err
+}
+
+func (b *Breaker) StoreLink(ctx context.Context, link *domain.Link) error {
+	return b.call(ctx, func(ctx context.Context) error {
+		return b.redis.StoreLink(ctx, link)
+	})
+}
+
+func (b *Breaker) StoreMissing(ctx context.Context, code string) error {
+	return b.call(ctx, func(ctx context.Context) error {
+		return b.redis.StoreMissing(ctx, code)
+	})
+}
+
+// DeleteLinks remembers codes it failed to drop, since Redis may still serve them after recovery
+func (b *Breaker) DeleteLinks(ctx context.Context, codes ...string) error {
+	err := b.call(ctx, func(ctx context.Context) error {
+		return b.redis.DeleteLinks(ctx, codes...)
+	})
+
+	if err != nil {
+		b.mu.Lock()
+		for _, code := range codes {
+			b.pending[code] = struct{}{}
+		}
+		b.mu.Unlock()
+	}
+
+	return err
+}
+
+func (b *Breaker) PublishInvalidation(ctx context.Context, codes ...string) error {
+	return b.call(ctx, func(ctx context.Context) error {
+		return b.redis.PublishInvalidation(ctx, codes...)
+	})
+}
+
+func (b *Breaker) PublishCreated(ctx context.Context, codes ...string) error {
+	return b.call(ctx, func(ctx context.Context) error {
+		return b.redis.PublishCreated(ctx, codes...)
+	})
+}
+
+// ListenInvalidations waits for Redis to recover before subscribing.
+// The breaker is opened at once, when the subscription fails.
+func (b *Breaker) ListenInvalidations(ctx context.Context, handle func(codes []string, created bool)) error {
+	for !b.Healthy() {
+		b.mu.Lock()
+		recovered := b.recovered
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-recovered:
+		}
+	}
+
+	err := b.redis.ListenInvalidations(ctx, handle)
+	if err != nil && ctx.Err() == nil {
+		b.mu.Lock()
+		b.trip(err)
+		b.mu.Unlock()
+	}
+
+	return err
+}
+
+// Run probes Redis while the breaker is open until ctx is done.
+func (b *Breaker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(b.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if !b.Healthy() {
+				b.probe(ctx)
+			}
+		}
+	}
+}
+
+func (b *Breaker) probe(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	err := b.redis.client.Ping(ctx).Err()
+	if err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// links changed during the outage are dropped before Redis serves them again
+	if len(b.pending) > 0 {
+		codes := make([]string, 0, len(b.pending))
+		for code := range b.pending {
+			codes = append(codes, code)
+		}
+
+		err = b.redis.DeleteLinks(ctx, codes...)
+		if err == nil {
+			err = b.redis.PublishInvalidation(ctx, codes...)
+		}
+
+		if err != nil {
+			b.logger.Error("failed to drop links changed during the cache outage", slog.String("error", err.Error()))
+			return
+		}
+
+		clear(b.pending)
+	}
+
+	b.failures = 0
+	b.open.Store(false)
+	close(b.recovered)
+
+	b.logger.Info("cache is recovered")
+}
+
+func (b *Breaker) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !b.Healthy() {
+		return domain.ErrCacheUnavailable
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+
+	err := fn(callCtx)
+
+	// calls aborted by callers, for example on client disconnects, tell nothing about Redis
+	if ctx.Err() == nil {
+		b.record(err)
+	}
+
+	return err
+}
+
+// record counts failed calls in a row, misses are not failures
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil || errors.Is(err, errKeyDoesNotExists) || errors.Is(err, domain.ErrURLNotFound) {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.trip(err)
+	}
+}
+
+// trip opens the breaker, it should be called with mu held
+func (b *Breaker) trip(err error) {
+	if b.open.Load() {
+		return
+	}
+
+	b.recovered = make(chan struct{})
+	b.open.Store(true)
+
+	b.logger.Warn("cache is unavailable, serving from the DB", slog.String("error", err.Error()))
+}
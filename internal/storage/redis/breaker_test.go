@@ -0,0 +1,107 @@
+package redis
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"url-shortner/internal/config"
+	"url-shortner/internal/domain"
+	"url-shortner/pkg/logger/slogdiscard"
+)
+
+func newTestConfig(host string) *config.RedisConfig {
+	return &config.RedisConfig{
+		Hosts:            []string{host},
+		TTL:              time.Minute,
+		MissingTTL:       time.Second,
+		Timeout:          100 * time.Millisecond,
+		FailureThreshold: 3,
+		ProbeInterval:    time.Second,
+	}
+}
+
+func TestBreaker_StartsOpenWhenRedisIsUnavailable(t *testing.T) {
+	// nothing listens on the port, so every call fails at once
+	cfg := newTestConfig("127.0.0.1:1")
+
+	rds, err := New(cfg, slogdiscard.NewDiscardLogger())
+	require.NoError(t, err)
+	defer rds.Close()
+
+	breaker := NewBreaker(rds, slogdiscard.NewDiscardLogger(), cfg)
+	ctx := context.Background()
+
+	assert.False(t, breaker.Healthy())
+
+	_, err = breaker.QueryLink(ctx, "abc")
+	assert.ErrorIs(t, err, domain.ErrCacheUnavailable)
+
+	// codes which failed to be dropped are dropped on recovery
+	err = breaker.DeleteLinks(ctx, "abc", "def")
+	assert.ErrorIs(t, err, domain.ErrCacheUnavailable)
+	assert.Len(t, breaker.pending, 2)
+
+	// listening waits for recovery
+	listenCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	err = breaker.ListenInvalidations(listenCtx, func([]string, bool) {})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestBreaker_OpensWhenRedisFails(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cfg := newTestConfig(mr.Addr())
+
+	rds, err := New(cfg, slogdiscard.NewDiscardLogger())
+	require.NoError(t, err)
+	defer rds.Close()
+
+	breaker := NewBreaker(rds, slogdiscard.NewDiscardLogger(), cfg)
+	ctx := context.Background()
+
+	assert.True(t, breaker.Healthy())
+
+	_, err = breaker.QueryLink(ctx, "abc")
+	assert.ErrorIs(t, err, errKeyDoesNotExists)
+
+	mr.Close()
+
+	for i := 0; i < cfg.FailureThreshold; i++ {
+		assert.True(t, breaker.Healthy())
+
+		_, err = breaker.QueryLink(ctx, "abc")
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, domain.ErrCacheUnavailable)
+	}
+
+	assert.False(t, breaker.Healthy())
+
+	_, err = breaker.QueryLink(ctx, "abc")
+	assert.ErrorIs(t, err, domain.ErrCacheUnavailable)
+}
+
+func TestBreaker_AbortedCallsAreNotFailures(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cfg := newTestConfig(mr.Addr())
+
+	rds, err := New(cfg, slogdiscard.NewDiscardLogger())
+	require.NoError(t, err)
+	defer rds.Close()
+
+	breaker := NewBreaker(rds, slogdiscard.NewDiscardLogger(), cfg)
+
+	// clients which disconnect cancel calls to a healthy Redis
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for i := 0; i < 2*cfg.FailureThreshold; i++ {
+		_, err = breaker.QueryLink(ctx, "abc")
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+
+	assert.True(t, breaker.Healthy())
+}
@@ -2,22 +2,58 @@ package redis
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/redis/go-redis/v9"
 	"log/slog"
-	"strconv"
+	"strings"
+	"time"
 	"url-shortner/internal/config"
 	"url-shortner/internal/domain"
 )
 
-const Key = "links"
+// KeyPrefix is the prefix of per-link keys, each link is cached under its own key with TTL,
+// so that entries expire individually and are spread over the cluster slots.
+const KeyPrefix = "codes"
+
+const migrateBatchSize = 1000
+
+// missingValue marks codes of links which don't exist
+const missingValue = ""
+
+// invalidationChannel delivers codes of updated and deleted links to in-process caches of all replicas
+const invalidationChannel = "codes:invalidations"
+
+// createdChannel delivers codes of new links to filters of existing codes of all replicas
+const createdChannel = "codes:created"
+
+// legacyHash is the hash of all links keyed by code, which is replaced by per-link keys
+const legacyHash = "codes"
+
+// legacyKeys are hashes of links keyed by id and of aliases, which are replaced by per-link keys.
+// They are discarded rather than migrated: entries keyed by id carry neither codes nor expiration,
+// and links are cached again from Postgres on the next redirect.
+var legacyKeys = []string{"links", "aliases"}
 
 var errKeyDoesNotExists = errors.New("key does not exists")
 
+// cachedLink is the part of domain.Link needed to serve a redirect
+type cachedLink struct {
+	ID           int        `json:"id"`
+	URL          string     `json:"url"`
+	ExpiresOn    *time.Time `json:"expires_on,omitempty"`
+	RedirectType int        `json:"redirect_type,omitempty"`
+}
+
 type Redis struct {
 	client redis.UniversalClient
 	logger *slog.Logger
+	ttl    time.Duration
+	// missingTTL is the TTL of missing codes, which is short, since links may be created under them
+	missingTTL time.Duration
+	// startErr is the error of the ping on start, the breaker starts open with it
+	startErr error
 }
 
 func New(config *config.RedisConfig, logger *slog.Logger) (*Redis, error) {
@@ -26,17 +62,29 @@ func New(config *config.RedisConfig, logger *slog.Logger) (*Redis, error) {
 		Password: config.Password,
 	})
 
-	_, err := client.Ping(context.Background()).Result()
+	// the app starts without Redis, the breaker reconnects in the background
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	defer cancel()
+
+	_, err := client.Ping(ctx).Result()
 	if err != nil {
-		return nil, fmt.Errorf("storage.redis.New: %w", err)
+		logger.Warn("redis is unavailable", slog.String("error", err.Error()))
 	}
 
 	return &Redis{
-		client: client,
-		logger: logger,
+		client:     client,
+		logger:     logger,
+		ttl:        config.TTL,
+		missingTTL: config.MissingTTL,
+		startErr:   err,
 	}, nil
 }
 
+// Available reports whether Redis answered the ping on start
+func (r *Redis) Available() bool {
+	return r.startErr == nil
+}
+
 func (r *Redis) Close() {
 	err := r.client.Close()
 	if err != nil {
@@ -44,29 +92,188 @@ func (r *Redis) Close() {
 	}
 }
 
-func (r *Redis) QueryLinkByID(ctx context.Context, id int) (string, error) {
-	if !r.hashExists(ctx) {
-		return "", errKeyDoesNotExists
+// DropLegacyKeys discards the caches keyed by link id, which are never read anymore.
+func (r *Redis) DropLegacyKeys(ctx context.Context) error {
+	// keys are unlinked one by one, since they may live in different cluster slots,
+	// large hashes are freed in the background without blocking Redis
+	for _, key := range legacyKeys {
+		err := r.client.Unlink(ctx, key).Err()
+		if err != nil {
+			return fmt.Errorf("storage.redis.DropLegacyKeys: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// MigrateHash moves links from the legacy hash to per-link keys and removes the hash.
+// Keys already cached by new replicas are kept, expired links are dropped.
+func (r *Redis) MigrateHash(ctx context.Context) error {
+	var cursor uint64
+
+	for {
+		values, next, err := r.client.HScan(ctx, legacyHash, cursor, "", migrateBatchSize).Result()
+		if err != nil {
+			return fmt.Errorf("storage.redis.MigrateHash: %w", err)
+		}
+
+		if len(values) > 0 {
+			pipe := r.client.Pipeline()
+			for i := 0; i+1 < len(values); i += 2 {
+				var cached cachedLink
+				if json.Unmarshal([]byte(values[i+1]), &cached) != nil {
+					continue
+				}
+
+				ttl := r.linkTTL(cached.ExpiresOn)
+				if ttl > 0 {
+					pipe.SetNX(ctx, linkKey(values[i]), values[i+1], ttl)
+				}
+			}
+
+			_, err = pipe.Exec(ctx)
+			if err != nil {
+				return fmt.Errorf("storage.redis.MigrateHash: %w", err)
+			}
+		}
+
+		if next == 0 {
+			break
+		}
+
+		cursor = next
+	}
+
+	err := r.client.Unlink(ctx, legacyHash).Err()
+	if err != nil {
+		return fmt.Errorf("storage.redis.MigrateHash: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Redis) QueryLink(ctx context.Context, code string) (*domain.Link, error) {
+	value, err := r.client.Get(ctx, linkKey(code)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, errKeyDoesNotExists
+		}
+
+		return nil, fmt.Errorf("storage.redis.QueryLink: %w", err)
+	}
+
+	if value == missingValue {
+		return nil, domain.ErrURLNotFound
+	}
+
+	var cached cachedLink
+	err = json.Unmarshal([]byte(value), &cached)
+	if err != nil {
+		return nil, fmt.Errorf("storage.redis.QueryLink: %w", err)
 	}
 
-	return r.client.HGet(ctx, Key, strconv.Itoa(id)).Result()
+	return &domain.Link{
+		ID:           cached.ID,
+		Code:         code,
+		URL:          cached.URL,
+		ExpiresOn:    cached.ExpiresOn,
+		RedirectType: cached.RedirectType,
+	}, nil
 }
 
 func (r *Redis) StoreLink(ctx context.Context, link *domain.Link) error {
-	err := r.client.HSet(ctx, Key, strconv.Itoa(link.ID), link.URL).Err()
+	value, err := json.Marshal(cachedLink{ID: link.ID, URL: link.URL, ExpiresOn: link.ExpiresOn, RedirectType: link.RedirectType})
 	if err != nil {
-		return fmt.Errorf("storage.redis.AddRoomClient: %w", err)
+		return fmt.Errorf("storage.redis.StoreLink: %w", err)
+	}
+
+	ttl := r.linkTTL(link.ExpiresOn)
+	if ttl <= 0 {
+		return nil
+	}
+
+	err = r.client.Set(ctx, linkKey(link.Code), value, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("storage.redis.StoreLink: %w", err)
+	}
+
+	return nil
+}
+
+func (r *Redis) StoreMissing(ctx context.Context, code string) error {
+	err := r.client.Set(ctx, linkKey(code), missingValue, r.missingTTL).Err()
+	if err != nil {
+		return fmt.Errorf("storage.redis.StoreMissing: %w", err)
 	}
 
 	return nil
 }
 
-func (r *Redis) hashExists(ctx context.Context) bool {
-	exists, err := r.client.Exists(ctx, Key).Result()
+func (r *Redis) DeleteLinks(ctx context.Context, codes ...string) error {
+	// keys are deleted one by one, since they may live in different cluster slots
+	pipe := r.client.Pipeline()
+	for _, code := range codes {
+		pipe.Del(ctx, linkKey(code))
+	}
+
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("storage.redis.DeleteLinks: %w", err)
+	}
+
+	return nil
+}
 
-	if err != nil || exists == 0 {
-		return false
+func (r *Redis) PublishInvalidation(ctx context.Context, codes ...string) error {
+	err := r.client.Publish(ctx, invalidationChannel, strings.Join(codes, " ")).Err()
+	if err != nil {
+		return fmt.Errorf("storage.redis.PublishInvalidation: %w", err)
 	}
 
-	return true
+	return nil
+}
+
+func (r *Redis) PublishCreated(ctx context.Context, codes ...string) error {
+	err := r.client.Publish(ctx, createdChannel, strings.Join(codes, " ")).Err()
+	if err != nil {
+		return fmt.Errorf("storage.redis.PublishCreated: %w", err)
+	}
+
+	return nil
+}
+
+// ListenInvalidations passes invalidated and created codes to handle until ctx is done or the subscription fails.
+// handle gets nil codes once subscribed.
+func (r *Redis) ListenInvalidations(ctx context.Context, handle func(codes []string, created bool)) error {
+	pubsub := r.client.Subscribe(ctx, invalidationChannel, createdChannel)
+	defer pubsub.Close()
+
+	_, err := pubsub.Receive(ctx)
+	if err != nil {
+		return fmt.Errorf("storage.redis.ListenInvalidations: %w", err)
+	}
+
+	handle(nil, false)
+
+	for {
+		msg, err := pubsub.ReceiveMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("storage.redis.ListenInvalidations: %w", err)
+		}
+
+		handle(strings.Fields(msg.Payload), msg.Channel == createdChannel)
+	}
+}
+
+// linkTTL never caches expiring links beyond their expiration, it is not positive for expired links
+func (r *Redis) linkTTL(expiresOn *time.Time) time.Duration {
+	if expiresOn == nil {
+		return r.ttl
+	}
+
+	return min(r.ttl, time.Until(*expiresOn))
+}
+
+func linkKey(code string) string {
+	return fmt.Sprintf("%s:%s", KeyPrefix, code)
 }
@@ -0,0 +1,84 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+	"url-shortner/pkg/logger/slogdiscard"
+)
+
+func newTestRedis(t *testing.T) (*Redis, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+
+	rds, err := New(newTestConfig(mr.Addr()), slogdiscard.NewDiscardLogger())
+	require.NoError(t, err)
+	t.Cleanup(rds.Close)
+
+	return rds, mr
+}
+
+func TestRedis_DropLegacyKeys(t *testing.T) {
+	rds, mr := newTestRedis(t)
+	ctx := context.Background()
+
+	// the baseline cached urls by link id
+	mr.HSet("links", "1", "https://example.com/1", "2", "https://example.com/2")
+	mr.HSet("aliases", "alias", "3")
+	require.NoError(t, mr.Set(linkKey("b"), `{"id":1,"url":"https://example.com/1"}`))
+
+	require.NoError(t, rds.DropLegacyKeys(ctx))
+
+	assert.False(t, mr.Exists("links"))
+	assert.False(t, mr.Exists("aliases"))
+	assert.True(t, mr.Exists(linkKey("b")))
+
+	// dropping is idempotent, so it is retried on the next start
+	require.NoError(t, rds.DropLegacyKeys(ctx))
+}
+
+func TestRedis_MigrateHash(t *testing.T) {
+	rds, mr := newTestRedis(t)
+	ctx := context.Background()
+
+	count := 2*migrateBatchSize + 1
+	for i := 0; i < count; i++ {
+		value, err := json.Marshal(cachedLink{ID: i, URL: fmt.Sprintf("https://example.com/%d", i)})
+		require.NoError(t, err)
+
+		mr.HSet(legacyHash, fmt.Sprintf("c%d", i), string(value))
+	}
+
+	expired := time.Now().Add(-time.Hour)
+	value, err := json.Marshal(cachedLink{ID: count, URL: "https://example.com/expired", ExpiresOn: &expired})
+	require.NoError(t, err)
+	mr.HSet(legacyHash, "expired", string(value))
+	mr.HSet(legacyHash, "malformed", "{")
+
+	// links cached by new replicas are fresher than the legacy hash
+	require.NoError(t, mr.Set(linkKey("c0"), `{"id":0,"url":"https://example.com/updated"}`))
+
+	require.NoError(t, rds.MigrateHash(ctx))
+
+	assert.False(t, mr.Exists(legacyHash))
+	assert.False(t, mr.Exists(linkKey("expired")))
+	assert.False(t, mr.Exists(linkKey("malformed")))
+
+	link, err := rds.QueryLink(ctx, "c0")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/updated", link.URL)
+
+	for _, i := range []int{1, migrateBatchSize, count - 1} {
+		code := fmt.Sprintf("c%d", i)
+
+		link, err = rds.QueryLink(ctx, code)
+		require.NoError(t, err)
+		assert.Equal(t, i, link.ID)
+		assert.Equal(t, fmt.Sprintf("https://example.com/%d", i), link.URL)
+		assert.Equal(t, rds.ttl, mr.TTL(linkKey(code)))
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE links ADD COLUMN alias VARCHAR(25) UNIQUE;
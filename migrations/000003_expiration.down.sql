@@ -0,0 +1,3 @@
+DROP INDEX expires_on_idx;
+
+ALTER TABLE links DROP COLUMN expires_on;
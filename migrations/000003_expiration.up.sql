@@ -0,0 +1,3 @@
+ALTER TABLE links ADD COLUMN expires_on TIMESTAMPTZ;
+
+CREATE INDEX expires_on_idx ON links (expires_on) WHERE expires_on IS NOT NULL;
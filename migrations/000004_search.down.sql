@@ -0,0 +1,8 @@
+DROP INDEX alias_trgm_idx;
+DROP INDEX url_trgm_idx;
+DROP INDEX host_idx;
+DROP INDEX short_code_idx;
+
+ALTER TABLE links DROP COLUMN host;
+
+DROP FUNCTION base62(BIGINT);
@@ -0,0 +1,27 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- mirrors encoder.Encode, so that generated short codes can be searched by prefix
+CREATE FUNCTION base62(n BIGINT) RETURNS TEXT AS $$
+DECLARE
+    alphabet CONSTANT TEXT := 'abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789';
+    code TEXT := '';
+BEGIN
+    IF n = 0 THEN
+        RETURN 'a';
+    END IF;
+
+    WHILE n > 0 LOOP
+        code := substr(alphabet, (n % 62)::INT + 1, 1) || code;
+        n := n / 62;
+    END LOOP;
+
+    RETURN code;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE STRICT;
+
+ALTER TABLE links ADD COLUMN host TEXT GENERATED ALWAYS AS (lower(substring(url from '^[a-zA-Z]+://(?:[^@/]*@)?([^/:?#]+)'))) STORED;
+
+CREATE INDEX short_code_idx ON links (COALESCE(alias, base62(id)) text_pattern_ops);
+CREATE INDEX host_idx ON links (host);
+CREATE INDEX url_trgm_idx ON links USING gin (url gin_trgm_ops);
+CREATE INDEX alias_trgm_idx ON links USING gin (alias gin_trgm_ops);
@@ -0,0 +1 @@
+ALTER TABLE links ADD COLUMN clicks BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,14 @@
+CREATE TABLE clicks (
+    link_id INTEGER NOT NULL,
+    clicked_at TIMESTAMPTZ NOT NULL,
+    referrer TEXT NOT NULL DEFAULT '',
+    browser TEXT NOT NULL,
+    os TEXT NOT NULL,
+    device TEXT NOT NULL,
+    bot BOOLEAN NOT NULL DEFAULT FALSE
+) PARTITION BY RANGE (clicked_at);
+
+CREATE INDEX clicks_link_idx ON clicks (link_id, clicked_at);
+
+-- monthly partitions are created by the app, the default one catches the rest
+CREATE TABLE clicks_default PARTITION OF clicks DEFAULT;
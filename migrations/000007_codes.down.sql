@@ -0,0 +1,23 @@
+DROP INDEX code_pattern_idx;
+
+CREATE FUNCTION base62(n BIGINT) RETURNS TEXT AS $$
+DECLARE
+    alphabet CONSTANT TEXT := 'abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789';
+    code TEXT := '';
+BEGIN
+    IF n = 0 THEN
+        RETURN 'a';
+    END IF;
+
+    WHILE n > 0 LOOP
+        code := substr(alphabet, (n % 62)::INT + 1, 1) || code;
+        n := n / 62;
+    END LOOP;
+
+    RETURN code;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE STRICT;
+
+CREATE INDEX short_code_idx ON links (COALESCE(alias, base62(id)) text_pattern_ops);
+
+ALTER TABLE links DROP COLUMN code;
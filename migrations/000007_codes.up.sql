@@ -0,0 +1,9 @@
+ALTER TABLE links ADD COLUMN code VARCHAR(32) UNIQUE;
+
+-- aliases are codes themselves, generated codes of existing links are backfilled by the app on startup
+UPDATE links SET code = alias WHERE alias IS NOT NULL;
+
+DROP INDEX short_code_idx;
+DROP FUNCTION base62(BIGINT);
+
+CREATE INDEX code_pattern_idx ON links (code text_pattern_ops);
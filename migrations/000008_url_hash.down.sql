@@ -0,0 +1,3 @@
+DROP INDEX url_hash_idx;
+
+ALTER TABLE links DROP COLUMN url_hash;
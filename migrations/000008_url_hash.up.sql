@@ -0,0 +1,9 @@
+ALTER TABLE links ADD COLUMN url_hash BYTEA;
+
+-- only the oldest of duplicated links is deduplicated to, the others keep resolving by their codes
+UPDATE links SET url_hash = sha256(convert_to(url, 'UTF8'))
+WHERE id IN (
+    SELECT min(id) FROM links WHERE alias IS NULL AND expires_on IS NULL GROUP BY url
+);
+
+CREATE UNIQUE INDEX url_hash_idx ON links (url_hash) WHERE alias IS NULL AND expires_on IS NULL;
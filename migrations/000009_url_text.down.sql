@@ -0,0 +1,10 @@
+DROP INDEX host_idx;
+ALTER TABLE links DROP COLUMN host;
+
+-- fails if longer urls are stored, instead of truncating them
+ALTER TABLE links ALTER COLUMN url TYPE VARCHAR(255);
+
+ALTER TABLE links ADD COLUMN host TEXT GENERATED ALWAYS AS (lower(substring(url from '^[a-zA-Z]+://(?:[^@/]*@)?([^/:?#]+)'))) STORED;
+CREATE INDEX host_idx ON links (host);
+
+CREATE INDEX url_idx ON links (url);
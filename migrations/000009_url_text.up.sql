@@ -0,0 +1,14 @@
+-- urls up to 2048 chars are accepted, b-tree index entries can't hold them, so urls are looked up by url_hash
+DROP INDEX url_idx;
+
+-- the generated column has to be dropped to change the type of the column it is generated from
+DROP INDEX host_idx;
+ALTER TABLE links DROP COLUMN host;
+
+ALTER TABLE links ALTER COLUMN url TYPE TEXT;
+
+ALTER TABLE links ADD COLUMN host TEXT GENERATED ALWAYS AS (lower(substring(url from '^[a-zA-Z]+://(?:[^@/]*@)?([^/:?#]+)'))) STORED;
+CREATE INDEX host_idx ON links (host);
+
+-- url_hash is not backfilled: NULL also marks links whose url was changed by PATCH, which are never deduplicated to.
+-- Links inserted without hash by the app running during the previous migration are just left out of deduplication.
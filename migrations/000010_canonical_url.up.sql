@@ -0,0 +1,7 @@
+-- links are deduplicated by the canonical url, the original one is still used for redirects.
+-- Existing links keep their url hash, urls which are already canonical are deduplicated to as before.
+ALTER TABLE links ADD COLUMN canonical_url TEXT;
+
+UPDATE links SET canonical_url = url;
+
+ALTER TABLE links ALTER COLUMN canonical_url SET NOT NULL;
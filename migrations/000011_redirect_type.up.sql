@@ -0,0 +1,2 @@
+-- links without redirect type are redirected with the configured default status
+ALTER TABLE links ADD COLUMN redirect_type SMALLINT CHECK (redirect_type IN (301, 302, 307, 308));
@@ -0,0 +1 @@
+DROP INDEX top_clicks_idx;
@@ -0,0 +1,2 @@
+-- links are preloaded into the cache page by page with keyset pagination on (clicks, id)
+CREATE INDEX top_clicks_idx ON links (clicks, id) WHERE code IS NOT NULL;
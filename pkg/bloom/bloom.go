@@ -0,0 +1,71 @@
+package bloom
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// Filter is the Bloom filter over strings, safe for concurrent use.
+// MayContain never returns false for added strings,
+// and returns true for other strings with about the configured probability.
+type Filter struct {
+	mu     sync.RWMutex
+	bits   []uint64
+	size   uint64
+	hashes int
+}
+
+// New returns the filter sized for capacity strings with the given false positive rate.
+func New(capacity int, falsePositiveRate float64) *Filter {
+	capacity = max(capacity, 1)
+
+	size := math.Ceil(-float64(capacity) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	hashes := int(math.Round(size / float64(capacity) * math.Ln2))
+
+	words := (uint64(size) + 63) / 64
+
+	return &Filter{
+		bits:   make([]uint64, words),
+		size:   words * 64,
+		hashes: max(hashes, 1),
+	}
+}
+
+func (f *Filter) Add(s string) {
+	h1, h2 := hash(s)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := 0; i < f.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % f.size
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *Filter) MayContain(s string) bool {
+	h1, h2 := hash(s)
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for i := 0; i < f.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % f.size
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hash returns two hashes of s, which are combined into the filter hashes
+func hash(s string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	sum := h.Sum64()
+
+	// the second hash is odd, so that it never degenerates to a single bit
+	return sum, (sum>>32 | sum<<32) | 1
+}
@@ -0,0 +1,28 @@
+package bloom
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	filter := New(10000, 0.01)
+
+	for i := 0; i < 10000; i++ {
+		filter.Add(fmt.Sprintf("code-%d", i))
+	}
+
+	for i := 0; i < 10000; i++ {
+		assert.True(t, filter.MayContain(fmt.Sprintf("code-%d", i)))
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.MayContain(fmt.Sprintf("other-%d", i)) {
+			falsePositives++
+		}
+	}
+
+	assert.Less(t, falsePositives, 300)
+}